@@ -0,0 +1,229 @@
+package goldy
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// LoadTar loads a Fixtures from the tar archive read from r. The fixture
+// paths are the names of the regular files in the archive, which must not be
+// absolute or leave the archive root.
+func LoadTar(r io.Reader) (Fixtures, error) {
+	s := Fixtures{}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return s, nil
+		} else if err != nil {
+			return s, err
+		} else if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		key := fixtureKey(filepath.FromSlash(hdr.Name))
+		if err := checkLocal(key); err != nil {
+			return s, err
+		} else if _, ok := s[key]; ok {
+			return s, fmt.Errorf("duplicate fixture: %s", key)
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return s, err
+		}
+		s[key] = data
+	}
+}
+
+// LoadZip loads a Fixtures from the zip archive of the given size read from
+// r, e.g. an *os.File or a *bytes.Reader. The fixture paths are the names of
+// the regular files in the archive, directory entries are skipped. Like for
+// LoadTar, the names must not be absolute or leave the archive root.
+func LoadZip(r io.ReaderAt, size int64) (Fixtures, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	s := Fixtures{}
+	for _, file := range zr.File {
+		if !file.Mode().IsRegular() {
+			continue
+		}
+		key := fixtureKey(filepath.FromSlash(file.Name))
+		if err := checkLocal(key); err != nil {
+			return s, err
+		} else if _, ok := s[key]; ok {
+			return s, fmt.Errorf("duplicate fixture: %s", key)
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return s, err
+		}
+		data, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return s, err
+		}
+		s[key] = data
+	}
+	return s, nil
+}
+
+// WriteTar writes f as a tar archive to w. The archive is deterministic, i.e.
+// the entries are sorted by path and carry no timestamps or owners.
+func (f Fixtures) WriteTar(w io.Writer) error {
+	tw := tar.NewWriter(w)
+	for _, path := range f.Paths() {
+		data := f[path]
+		hdr := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     filepath.ToSlash(path),
+			Mode:     0600,
+			Size:     int64(len(data)),
+			ModTime:  time.Unix(0, 0),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		} else if _, err := tw.Write(data); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// archivePath returns the path of the archive file used if gf.Archive is set.
+func (gf *GoldenFixtures) archivePath() string {
+	return gf.Dir + ".tar"
+}
+
+// loadArchive loads the golden fixtures from the archive file that are not
+// excluded by gf.Exclude.
+func (gf *GoldenFixtures) loadArchive() (Fixtures, error) {
+	s, err := gf.readArchive()
+	return s.Filter(func(path string) bool { return !gf.Exclude(filepath.FromSlash(path)) }), err
+}
+
+// readArchive reads all entries from the archive file, including excluded
+// ones. The paths inside the archive are relative to gf.Dir.
+func (gf *GoldenFixtures) readArchive() (Fixtures, error) {
+	file, err := os.Open(gf.archivePath())
+	if err != nil {
+		return Fixtures{}, err
+	}
+	defer file.Close()
+	rel, err := LoadTar(file)
+	if err != nil {
+		return nil, err
+	}
+	s := Fixtures{}
+	for path, data := range rel {
+		s[gf.join(path)] = data
+	}
+	return s, nil
+}
+
+// updateArchive resolves diff by rewriting the archive file. The new archive
+// is written to a temporary file first, which then replaces the old one.
+// Excluded entries are kept as they are.
+func (gf *GoldenFixtures) updateArchive(diff Diff) error {
+	if len(diff) == 0 {
+		return nil
+	}
+	s, err := gf.readArchive()
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	rel, err := gf.applyDiff(s, diff)
+	if err != nil {
+		return err
+	}
+	buf := &bytes.Buffer{}
+	if err := rel.WriteTar(buf); err != nil {
+		return err
+	}
+
+	path := gf.archivePath()
+	if err := os.MkdirAll(filepath.Dir(path), gf.dirMode()); err != nil {
+		return err
+	}
+	if err := writeFile(path, buf.Bytes(), gf.fileMode()); err != nil {
+		return err
+	}
+	gf.logf("goldy: wrote: %s", path)
+	return nil
+}
+
+// applyDiff resolves diff in the golden fixtures s and returns the result
+// with paths relative to gf.Dir. It is used for golden fixtures that are
+// written as a whole, see Archive and Store.
+func (gf *GoldenFixtures) applyDiff(s Fixtures, diff Diff) (Fixtures, error) {
+	for _, d := range diff {
+		switch d.Kind {
+		case DiffUnexpected:
+			delete(s, d.Path)
+		case DiffMissing, DiffChanged:
+			s[d.Path] = d.B
+		}
+	}
+	rel := Fixtures{}
+	for path, data := range s {
+		relPath, err := filepath.Rel(gf.Dir, filepath.FromSlash(path))
+		if err != nil {
+			return nil, err
+		}
+		rel[fixtureKey(relPath)] = data
+	}
+	return rel, nil
+}
+
+// gzipData compresses data deterministically, i.e. without a file name or
+// modification time in the gzip header.
+func gzipData(data []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	zw, err := gzip.NewWriterLevel(buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	} else if _, err := zw.Write(data); err != nil {
+		return nil, err
+	} else if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// base64Data encodes data as base64 with lines of at most 76 characters, so
+// line based diffs of changed binary data stay readable.
+func base64Data(data []byte) []byte {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	buf := &bytes.Buffer{}
+	for len(encoded) > 76 {
+		buf.WriteString(encoded[:76] + "\n")
+		encoded = encoded[76:]
+	}
+	buf.WriteString(encoded + "\n")
+	return buf.Bytes()
+}
+
+// unbase64Data decodes data encoded by base64Data. Line breaks are ignored.
+func unbase64Data(data []byte) ([]byte, error) {
+	data = bytes.Replace(data, []byte("\r"), nil, -1)
+	return base64.StdEncoding.DecodeString(string(bytes.Replace(data, []byte("\n"), nil, -1)))
+}
+
+// gunzipData decompresses data.
+func gunzipData(data []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return ioutil.ReadAll(zr)
+}
@@ -0,0 +1,297 @@
+package goldy
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTar(t *testing.T) {
+	want, err := gc.InputFixtures("in", "nested")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := want.WriteTar(buf); err != nil {
+		t.Fatal(err)
+	}
+	buf2 := &bytes.Buffer{}
+	if err := want.WriteTar(buf2); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(buf.Bytes(), buf2.Bytes()) {
+		t.Fatal("WriteTar is not deterministic")
+	}
+
+	got, err := LoadTar(buf)
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got=%#v want=%#v", got, want)
+	}
+
+	buf.Reset()
+	tw := tar.NewWriter(buf)
+	for _, name := range []string{"a.txt", "./a.txt"} {
+		if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0600}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	} else if _, err := LoadTar(buf); err == nil || err.Error() != "duplicate fixture: a.txt" {
+		t.Fatalf("got err=%v want duplicate fixture", err)
+	}
+}
+
+func TestLoadZip(t *testing.T) {
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	if _, err := zw.Create("dir/"); err != nil {
+		t.Fatal(err)
+	}
+	files := []struct{ Name, Data string }{
+		{"a.txt", "file a\n"},
+		{"dir/b.txt", "file b\n"},
+		{"dir/sub/c.txt", ""},
+	}
+	for _, file := range files {
+		if w, err := zw.Create(file.Name); err != nil {
+			t.Fatal(err)
+		} else if _, err := w.Write([]byte(file.Data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := LoadZip(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Fixtures{"a.txt": []byte("file a\n"), "dir/b.txt": []byte("file b\n"), "dir/sub/c.txt": []byte{}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got=%#v want=%#v", got, want)
+	}
+
+	if _, err := LoadZip(bytes.NewReader([]byte("not a zip")), 9); err == nil {
+		t.Fatal("got err=nil")
+	}
+
+	// Entries outside of the archive root are rejected.
+	for _, name := range []string{"../x", "a/../../x", "/x"} {
+		buf := &bytes.Buffer{}
+		zw := zip.NewWriter(buf)
+		if _, err := zw.Create(name); err != nil {
+			t.Fatal(err)
+		} else if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadZip(bytes.NewReader(buf.Bytes()), int64(buf.Len())); err == nil || !strings.HasPrefix(err.Error(), "path outside of root: ") {
+			t.Errorf("%s: got err=%v want path outside of root", name, err)
+		}
+		buf.Reset()
+		tw := tar.NewWriter(buf)
+		if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0600}); err != nil {
+			t.Fatal(err)
+		} else if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadTar(buf); err == nil || !strings.HasPrefix(err.Error(), "path outside of root: ") {
+			t.Errorf("%s: got err=%v want path outside of root", name, err)
+		}
+	}
+}
+
+func TestGoldenFixturesArchive(t *testing.T) {
+	c := gc
+	c.Dir = testDir(t)
+	c.Archive = true
+	c.Flags = ""
+	gf := c.GoldenFixtures("golden")
+	gf.Add([]byte("file a\n"), "a.txt")
+	gf.Add([]byte("file d\n"), "c", "d.txt")
+
+	if err := gf.Test(); err == nil {
+		t.Fatal("got err=nil")
+	}
+	gf.Flags = "update"
+	if err := gf.Test(); err != nil {
+		t.Fatal(err)
+	}
+	gf.Flags = ""
+	if err := gf.Test(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(c.Dir, "golden.tar")); err != nil {
+		t.Fatal(err)
+	} else if _, err := os.Stat(filepath.Join(c.Dir, "golden")); !os.IsNotExist(err) {
+		t.Fatalf("got err=%v want not exist", err)
+	}
+
+	gf2 := c.GoldenFixtures("golden")
+	gf2.Add([]byte("file a\n"), "a.txt")
+	if diff, err := gf2.Diff(); err != nil {
+		t.Fatal(err)
+	} else if len(diff) != 1 || diff[0].Kind != DiffUnexpected {
+		t.Fatalf("got=%#v want one unexpected file", diff)
+	}
+	gf2.Flags = "update"
+	if err := gf2.Test(); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := gf2.loadArchive(); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(got, gf2.Fixtures) {
+		t.Fatalf("got=%#v want=%#v", got, gf2.Fixtures)
+	}
+}
+
+func TestGoldenFixturesArchiveExclude(t *testing.T) {
+	c := TempConfig(t)
+	c.Archive = true
+	gf := c.GoldenFixtures("golden")
+	archive := Fixtures{"a.txt": []byte("old"), "b.txt": []byte("old"), ".keep": []byte{}}
+	buf := &bytes.Buffer{}
+	if err := archive.WriteTar(buf); err != nil {
+		t.Fatal(err)
+	} else if err := ioutil.WriteFile(gf.archivePath(), buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Updates and rewrites leave excluded entries alone.
+	for _, flags := range []string{"update", "rewrite"} {
+		gf := c.GoldenFixtures("golden")
+		gf.Flags = flags
+		gf.Add([]byte(flags), "a.txt")
+		if err := gf.Test(); err != nil {
+			t.Fatal(err)
+		}
+		want := Fixtures{gf.join("a.txt"): []byte(flags), gf.join(".keep"): []byte{}}
+		if got, err := gf.readArchive(); err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: got=%q want=%q", flags, got, want)
+		}
+	}
+}
+
+func TestGoldenFixturesCompress(t *testing.T) {
+	c := gc
+	c.Dir = testDir(t)
+	c.Compress = true
+	data := bytes.Repeat([]byte("log line\n"), 100)
+
+	gf := c.GoldenFixtures()
+	gf.Flags = "update"
+	gf.Add(data, "a.log")
+	if err := gf.Test(); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(c.Dir, "a.log.gz")
+	compressed, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	} else if got, err := gunzipData(compressed); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(got, data) {
+		t.Fatalf("got=%q want=%q", got, data)
+	} else if again, err := gzipData(data); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(again, compressed) {
+		t.Fatal("gzipData is not deterministic")
+	}
+
+	// A file compressed with a different header must not cause a diff.
+	buf := &bytes.Buffer{}
+	zw := gzip.NewWriter(buf)
+	zw.Name = "a.log"
+	zw.ModTime = time.Now()
+	zw.Write(data)
+	zw.Close()
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	gf.Flags = ""
+	if err := gf.Test(); err != nil {
+		t.Fatal(err)
+	}
+
+	gf = c.GoldenFixtures()
+	gf.Flags = "update"
+	if err := gf.Test(); err != nil {
+		t.Fatal(err)
+	} else if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("got err=%v want not exist", err)
+	}
+}
+
+func TestGoldenFixturesEncodeBinary(t *testing.T) {
+	c := gc
+	c.Dir = testDir(t)
+	c.EncodeBinary = true
+	img := encodePNG(t, grayImage(30, 30, func(x, y int) uint8 { return uint8(x * y) }))
+
+	gf := c.GoldenFixtures()
+	gf.Flags = "update"
+	gf.Add(img, "img.png")
+	gf.Add([]byte("text"), "a.txt")
+	if err := gf.Test(); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(c.Dir, "img.png.b64")
+	encoded, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	} else if isBinary(encoded) {
+		t.Fatalf("got binary data in: %s", path)
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(string(encoded), "\n"), "\n") {
+		if len(line) > 76 {
+			t.Fatalf("got=%d want<=%d", len(line), 76)
+		}
+	}
+	if decoded, err := unbase64Data(encoded); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(decoded, img) {
+		t.Fatalf("got=%q want=%q", decoded, img)
+	} else if data, err := ioutil.ReadFile(filepath.Join(c.Dir, "a.txt")); err != nil {
+		t.Fatal(err)
+	} else if string(data) != "text" {
+		t.Fatalf("got=%q want=%q", data, "text")
+	}
+	gf.Flags = ""
+	if err := gf.Test(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The decoded content is compared.
+	gf = c.GoldenFixtures()
+	gf.Add(encodePNG(t, grayImage(30, 30, func(x, y int) uint8 { return 0 })), "img.png")
+	gf.Add([]byte("text"), "a.txt")
+	want := "1 errors:\nchanged file: " + filepath.Join(c.Dir, "img.png")
+	if err := gf.Test(); err == nil || !strings.HasPrefix(err.Error(), want) {
+		t.Fatalf("got err=%v want=%s", err, want)
+	}
+
+	// A fixture that is no longer binary replaces the encoded file.
+	gf = c.GoldenFixtures()
+	gf.Flags = "update"
+	gf.Add([]byte("not an image"), "img.png")
+	if err := gf.Test(); err != nil {
+		t.Fatal(err)
+	} else if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("got err=%v want not exist", err)
+	} else if _, err := os.Stat(filepath.Join(c.Dir, "a.txt")); !os.IsNotExist(err) {
+		t.Fatalf("got err=%v want not exist", err)
+	}
+}
@@ -0,0 +1,93 @@
+package goldy
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// defaultAutoExt is used by GoldenAuto if Config.AutoExt is empty.
+const defaultAutoExt = ".golden"
+
+// GoldenAuto is like Golden, but derives the path of the golden fixture
+// inside c.Dir from t.Name(). Subtests become subdirectories, characters that
+// are not allowed in file names on Windows are replaced with "_" and
+// c.AutoExt is appended, e.g. "TestFoo/a:b" becomes "TestFoo/a_b.golden". It
+// panics if it's called more than once for the same test.
+func (c Config) GoldenAuto(t testing.TB, data []byte) {
+	t.Helper()
+	path := autoPath(t.Name(), c.AutoExt)
+	autoPaths.claim(t, fixtureKey(filepath.Join(c.Dir, path)))
+	c.Golden(t, data, path)
+}
+
+// autoPaths holds the paths claimed by GoldenAuto for the currently running
+// tests.
+var autoPaths autoRegistry
+
+// autoRegistry detects GoldenAuto calls that derive the same path.
+type autoRegistry struct {
+	mu    sync.Mutex
+	paths map[string]string
+}
+
+// claim panics if path is already claimed, or claims it for the test t until
+// t completes.
+func (r *autoRegistry) claim(t testing.TB, path string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.paths == nil {
+		r.paths = map[string]string{}
+	}
+	if name, ok := r.paths[path]; ok {
+		panic(fmt.Sprintf("set already has path: %s (claimed by %s)", path, name))
+	}
+	r.paths[path] = t.Name()
+	t.Cleanup(func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.paths, path)
+	})
+}
+
+// autoPath returns the path derived from the given test name by GoldenAuto.
+func autoPath(name, ext string) string {
+	if ext == "" {
+		ext = defaultAutoExt
+	}
+	parts := strings.Split(name, "/")
+	for i, part := range parts {
+		parts[i] = sanitizeName(part)
+	}
+	return filepath.Join(parts...) + ext
+}
+
+// sanitizeName returns name with all characters that are not allowed in file
+// names on Windows replaced by "_". An "_" is appended to names that are
+// still invalid, i.e. empty names, names ending with a dot or space and
+// reserved device names like "NUL".
+func sanitizeName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	stem := strings.ToUpper(strings.SplitN(name, ".", 2)[0])
+	if name == "" || strings.HasSuffix(name, ".") || strings.HasSuffix(name, " ") || reservedNames[stem] {
+		name += "_"
+	}
+	return name
+}
+
+// reservedNames holds the device names that can't be used as file names on
+// Windows, regardless of their extension.
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
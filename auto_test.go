@@ -0,0 +1,78 @@
+package goldy
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAutoPath(t *testing.T) {
+	tests := []struct {
+		Name string
+		Ext  string
+		Want string
+	}{
+		{Name: "TestFoo", Want: "TestFoo.golden"},
+		{Name: "TestFoo", Ext: ".json", Want: "TestFoo.json"},
+		{Name: "TestFoo/bar", Want: filepath.Join("TestFoo", "bar.golden")},
+		{Name: "TestFoo/a/b", Want: filepath.Join("TestFoo", "a", "b.golden")},
+		{Name: `TestFoo/a:b<c>d"e\f|g?h*i`, Want: filepath.Join("TestFoo", "a_b_c_d_e_f_g_h_i.golden")},
+		{Name: "TestFoo/tab\there", Want: filepath.Join("TestFoo", "tab_here.golden")},
+		{Name: "TestFoo/..", Want: filepath.Join("TestFoo", ".._.golden")},
+		{Name: "TestFoo/trailing.", Want: filepath.Join("TestFoo", "trailing._.golden")},
+		{Name: "TestFoo/nul", Want: filepath.Join("TestFoo", "nul_.golden")},
+		{Name: "TestFoo/COM1.txt", Want: filepath.Join("TestFoo", "COM1.txt_.golden")},
+		{Name: "TestFoo/CONSOLE", Want: filepath.Join("TestFoo", "CONSOLE.golden")},
+		{Name: "TestFoo/", Want: filepath.Join("TestFoo", "_.golden")},
+	}
+	for _, test := range tests {
+		if got := autoPath(test.Name, test.Ext); got != test.Want {
+			t.Errorf("%q: got=%q want=%q", test.Name, got, test.Want)
+		}
+	}
+}
+
+func TestGoldenAuto(t *testing.T) {
+	c := gc
+	c.Dir = testDir(t)
+	c.Flags = string(FlagUpdate)
+	t.Run("a:b", func(t *testing.T) {
+		c.GoldenAuto(t, []byte("a"))
+		data, err := ioutil.ReadFile(filepath.Join(c.Dir, "TestGoldenAuto", "a_b.golden"))
+		if err != nil {
+			t.Fatal(err)
+		} else if string(data) != "a" {
+			t.Errorf("got=%q want=%q", data, "a")
+		}
+
+		defer func() {
+			if r := recover(); r == nil {
+				t.Errorf("got=nil want=panic")
+			}
+		}()
+		c.GoldenAuto(t, []byte("b"))
+	})
+
+	c.Flags = ""
+	t.Run("a:b", func(t *testing.T) {
+		tb := &fakeTB{TB: t}
+		c.GoldenAuto(tb, []byte("a"))
+		if want := filepath.Join("TestGoldenAuto", "a_b#01.golden"); !strings.Contains(tb.fatal, want) {
+			t.Errorf("got fatal=%q want=%q", tb.fatal, want)
+		}
+	})
+}
+
+func TestAutoRegistry(t *testing.T) {
+	var r autoRegistry
+	// A path is released once the test that claimed it completes.
+	for _, name := range []string{"a", "b"} {
+		t.Run(name, func(t *testing.T) {
+			r.claim(t, "path")
+		})
+	}
+	if len(r.paths) != 0 {
+		t.Errorf("got=%v want=%v", r.paths, map[string]string{})
+	}
+}
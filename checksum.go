@@ -0,0 +1,103 @@
+package goldy
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ErrChecksumMismatch is wrapped by the error returned from
+// GoldenFixtures.Diff if VerifyChecksums is set and the golden fixtures on
+// disk don't match their checksum manifest. Unlike a regular diff, this
+// indicates that the golden fixtures themselves were corrupted, e.g. by a
+// bad merge.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// checksumPath returns the path of the checksum manifest used if
+// gf.VerifyChecksums is set.
+func (gf *GoldenFixtures) checksumPath() string {
+	return gf.Dir + ".sha256"
+}
+
+// verifyChecksums returns an error wrapping ErrChecksumMismatch if the golden
+// fixtures in want don't match the checksum manifest. Nothing is verified if
+// the manifest does not exist yet.
+func (gf *GoldenFixtures) verifyChecksums(want Fixtures) error {
+	data, err := ioutil.ReadFile(gf.checksumPath())
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	manifest, err := parseHashManifest(data)
+	if err != nil {
+		return fmt.Errorf("bad checksum manifest: %s: %s", gf.checksumPath(), err)
+	}
+	hashes := want.Sub(gf.Dir).Hashes()
+	var errs []string
+	for path, hash := range manifest {
+		if got, ok := hashes[path]; !ok {
+			errs = append(errs, "missing: "+path)
+		} else if got != hash {
+			errs = append(errs, "changed: "+path)
+		}
+	}
+	for path := range hashes {
+		if _, ok := manifest[path]; !ok {
+			errs = append(errs, "not in manifest: "+path)
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	sort.Strings(errs)
+	fix := "fix them"
+	if gf.Hint != "" {
+		fix += fmt.Sprintf(" or run `%s`", gf.Hint)
+	}
+	return fmt.Errorf(
+		"%w: %s:\n%s\n\nthe golden fixtures were modified outside of goldy, %s",
+		ErrChecksumMismatch,
+		gf.checksumPath(),
+		strings.Join(errs, "\n"),
+		fix,
+	)
+}
+
+// writeChecksums writes the checksum manifest for the golden fixtures
+// currently on disk.
+func (gf *GoldenFixtures) writeChecksums() error {
+	want, _, err := gf.load(nil)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	path := gf.checksumPath()
+	if err := os.MkdirAll(filepath.Dir(path), gf.dirMode()); err != nil {
+		return err
+	} else if err := writeFile(path, HashManifest(want.Sub(gf.Dir)), gf.fileMode()); err != nil {
+		return err
+	}
+	gf.logf("goldy: wrote: %s", path)
+	return nil
+}
+
+// parseHashManifest parses a manifest in the format returned by HashManifest
+// into a map of paths to hashes.
+func parseHashManifest(data []byte) (map[string]string, error) {
+	manifest := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		parts := strings.SplitN(scanner.Text(), "  ", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("line %d: expected \"hash  path\"", line)
+		}
+		manifest[parts[1]] = parts[0]
+	}
+	return manifest, scanner.Err()
+}
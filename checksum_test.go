@@ -0,0 +1,75 @@
+package goldy
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestGoldenFixturesVerifyChecksums(t *testing.T) {
+	c := TempConfig(t)
+	c.VerifyChecksums = true
+	newGF := func(flags string) *GoldenFixtures {
+		gf := c.GoldenFixtures("out")
+		gf.Flags = flags
+		gf.Add([]byte("a"), "a.txt")
+		gf.Add([]byte("b"), "sub", "b.txt")
+		return gf
+	}
+	if err := newGF(string(FlagUpdate)).Test(); err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := ioutil.ReadFile(filepath.Join(c.Dir, "out.sha256"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := string(HashManifest(Fixtures{"a.txt": []byte("a"), "sub/b.txt": []byte("b")}))
+	if string(manifest) != want {
+		t.Fatalf("got=%q want=%q", manifest, want)
+	} else if err := newGF("").Test(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A legitimate diff is not reported as corruption.
+	gf := newGF("")
+	gf.Add([]byte("c"), "c.txt")
+	if diff, err := gf.Diff(); err != nil {
+		t.Fatal(err)
+	} else if len(diff) != 1 {
+		t.Fatalf("got=%d want=%d", len(diff), 1)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(c.Dir, "out", "sub", "b.txt"), []byte("tampered"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, err = newGF("").Diff()
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("got=%v want=%v", err, ErrChecksumMismatch)
+	}
+	if err := newGF(string(FlagUpdate)).Test(); err != nil {
+		t.Fatal(err)
+	} else if err := newGF("").Test(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseHashManifest(t *testing.T) {
+	f := Fixtures{"a.txt": []byte("a"), "b/c.txt": nil}
+	got, err := parseHashManifest(HashManifest(f))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := f.Hashes()
+	if len(got) != len(want) {
+		t.Fatalf("got=%v want=%v", got, want)
+	}
+	for path, hash := range want {
+		if got[path] != hash {
+			t.Errorf("got=%q want=%q", got[path], hash)
+		}
+	}
+	if _, err := parseHashManifest([]byte("bad\n")); err == nil {
+		t.Errorf("got=nil want=error")
+	}
+}
@@ -0,0 +1,305 @@
+package goldy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"math/big"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// Comparator compares the golden data a with the data b produced by a test.
+// It returns true if both are considered equal, or false and a human readable
+// description of the difference otherwise. The diffs returned by the
+// comparators in this package use DefaultDiffContext lines of context.
+type Comparator func(a, b []byte) (equal bool, detail string)
+
+// compareWith applies the comparator registered for the file extension of every
+// changed file in diff. Files the comparator considers equal are removed
+// from the diff, all others get a Detail describing the difference.
+func (gf *GoldenFixtures) compareWith(diff Diff) Diff {
+	if len(gf.Comparators) == 0 {
+		return diff
+	}
+	var newDiff Diff
+	for _, d := range diff {
+		if cmp := gf.Comparators[filepath.Ext(d.Path)]; d.Kind == DiffChanged && cmp != nil {
+			equal, detail := cmp(d.A, d.B)
+			if equal {
+				continue
+			}
+			d.Detail = detail
+		}
+		newDiff = append(newDiff, d)
+	}
+	return newDiff
+}
+
+// JSONComparator returns a Comparator for JSON documents. Two documents are
+// equal if they decode to the same value, i.e. key order and whitespace are
+// ignored. Integers are compared exactly, even beyond the precision of a
+// float64. On mismatch the detail is a diff of both documents with sorted
+// keys and consistent indentation.
+func JSONComparator() Comparator {
+	return func(a, b []byte) (bool, string) {
+		valA, err := decodeJSON(a)
+		if err != nil {
+			return false, fmt.Sprintf("failed to decode golden JSON: %s", err)
+		}
+		valB, err := decodeJSON(b)
+		if err != nil {
+			return false, fmt.Sprintf("failed to decode JSON: %s", err)
+		} else if reflect.DeepEqual(valA, valB) {
+			return true, ""
+		}
+		return false, canonicalDiff(valA, valB)
+	}
+}
+
+// decodeJSON decodes data like json.Unmarshal into an interface{}, but keeps
+// numbers as json.Number values normalized by normalizeNumber.
+func decodeJSON(data []byte) (interface{}, error) {
+	// Unmarshal reports invalid documents, including trailing data, with
+	// better error messages than a Decoder.
+	if err := json.Unmarshal(data, new(json.RawMessage)); err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return normalizeNumbers(v), nil
+}
+
+// normalizeNumbers returns v with all json.Number values replaced by their
+// normalized form, see normalizeNumber.
+func normalizeNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, val := range v {
+			v[key] = normalizeNumbers(val)
+		}
+	case []interface{}:
+		for i, val := range v {
+			v[i] = normalizeNumbers(val)
+		}
+	case json.Number:
+		return normalizeNumber(v)
+	}
+	return v
+}
+
+// normalizeNumber returns n unmodified if it's an integer, and formatted as a
+// float64 otherwise, so e.g. "1" and "1.0" are equal.
+func normalizeNumber(n json.Number) json.Number {
+	if i, ok := new(big.Int).SetString(n.String(), 10); ok {
+		return json.Number(i.String())
+	} else if f, err := n.Float64(); err == nil {
+		return json.Number(strconv.FormatFloat(f, 'g', -1, 64))
+	}
+	return n
+}
+
+// YAMLComparator returns a Comparator for YAML documents that decodes them
+// using unmarshal, e.g. yaml.Unmarshal from gopkg.in/yaml.v3, which keeps
+// goldy itself free of a YAML dependency. Two documents are equal if they
+// decode to the same value, i.e. key order, quoting style and comments are
+// ignored. On mismatch the detail is a diff of both documents encoded as JSON
+// with sorted keys.
+func YAMLComparator(unmarshal func(data []byte, v interface{}) error) Comparator {
+	return func(a, b []byte) (bool, string) {
+		var valA, valB interface{}
+		if err := unmarshal(a, &valA); err != nil {
+			return false, fmt.Sprintf("failed to decode golden YAML: %s", err)
+		} else if err := unmarshal(b, &valB); err != nil {
+			return false, fmt.Sprintf("failed to decode YAML: %s", err)
+		}
+		valA, valB = stringKeys(valA), stringKeys(valB)
+		if reflect.DeepEqual(valA, valB) {
+			return true, ""
+		}
+		return false, canonicalDiff(valA, valB)
+	}
+}
+
+// stringKeys returns v with all map[interface{}]interface{} values, which
+// some YAML libraries decode mappings to, replaced by map[string]interface{}
+// values, so they can be encoded as JSON.
+func stringKeys(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			m[fmt.Sprint(key)] = stringKeys(val)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			m[key] = stringKeys(val)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, val := range v {
+			s[i] = stringKeys(val)
+		}
+		return s
+	}
+	return v
+}
+
+// canonicalDiff returns a unified diff of a and b encoded as indented JSON.
+func canonicalDiff(a, b interface{}) string {
+	// Marshaling interface{} values sorts map keys, so this only fails for
+	// values that can't be represented in JSON, which are shown as errors.
+	canonA, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		canonA = []byte(err.Error())
+	}
+	canonB, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		canonB = []byte(err.Error())
+	}
+	text, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:       difflib.SplitLines(string(canonA)),
+		B:       difflib.SplitLines(string(canonB)),
+		Context: DefaultDiffContext,
+	})
+	return strings.TrimRight(text, "\n")
+}
+
+// SortedLinesComparator returns a Comparator for text files whose lines may
+// be in any order, e.g. because they were produced by iterating over a map.
+// Two files are equal if they hold the same lines after sorting. On mismatch
+// the detail is a diff of the sorted lines. Use SortLines with
+// GoldenFixtures.Transform to also store the golden fixtures sorted.
+func SortedLinesComparator() Comparator {
+	return func(a, b []byte) (bool, string) {
+		a, b = SortLines(a), SortLines(b)
+		if bytes.Equal(a, b) {
+			return true, ""
+		}
+		text, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:       difflib.SplitLines(strings.TrimSuffix(string(a), "\n")),
+			B:       difflib.SplitLines(strings.TrimSuffix(string(b), "\n")),
+			Context: DefaultDiffContext,
+		})
+		return false, strings.TrimRight(text, "\n")
+	}
+}
+
+// SortLines returns a copy of data with its lines sorted in ascending byte
+// order, see SortedLinesComparator. A missing newline at the end of the last
+// line is added.
+func SortLines(data []byte) []byte {
+	if len(data) == 0 {
+		return data
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	sort.Strings(lines)
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
+
+// IgnoreBytes returns a Comparator for binary files that ignores the given
+// byte ranges, e.g. a timestamp in a file header. Every range holds a start
+// offset and an exclusive end offset, and ranges beyond the end of the data
+// are ignored. Use MaskBytes with GoldenFixtures.Transform to also keep the
+// ignored bytes stable in the golden fixtures on disk.
+func IgnoreBytes(ranges ...[2]int) Comparator {
+	return func(a, b []byte) (bool, string) {
+		a, b = MaskBytes(a, ranges...), MaskBytes(b, ranges...)
+		if bytes.Equal(a, b) {
+			return true, ""
+		}
+		return false, strings.Trim(binarySummary(a, b), "()")
+	}
+}
+
+// MaskBytes returns a copy of data with the bytes in the given ranges set to
+// zero, see IgnoreBytes.
+func MaskBytes(data []byte, ranges ...[2]int) []byte {
+	masked := append([]byte(nil), data...)
+	for _, r := range ranges {
+		for i := r[0]; i < r[1] && i < len(masked); i++ {
+			if i >= 0 {
+				masked[i] = 0
+			}
+		}
+	}
+	return masked
+}
+
+// ImageComparator returns a Comparator for images in any format registered
+// with the image package, PNG and JPEG by default. Two images are equal if
+// they have the same dimensions and no color channel of any pixel differs by
+// more than tolerance, which is a fraction between 0 and 1 of the maximum
+// channel value.
+func ImageComparator(tolerance float64) Comparator {
+	limit := int(tolerance * 0xff)
+	return func(a, b []byte) (bool, string) {
+		imgA, _, err := image.Decode(bytes.NewReader(a))
+		if err != nil {
+			return false, fmt.Sprintf("failed to decode golden image: %s", err)
+		}
+		imgB, _, err := image.Decode(bytes.NewReader(b))
+		if err != nil {
+			return false, fmt.Sprintf("failed to decode image: %s", err)
+		}
+		boundsA, boundsB := imgA.Bounds(), imgB.Bounds()
+		if boundsA.Dx() != boundsB.Dx() || boundsA.Dy() != boundsB.Dy() {
+			return false, fmt.Sprintf(
+				"dimensions differ: %dx%d -> %dx%d",
+				boundsA.Dx(), boundsA.Dy(), boundsB.Dx(), boundsB.Dy(),
+			)
+		}
+		var differ, maxDelta int
+		for y := 0; y < boundsA.Dy(); y++ {
+			for x := 0; x < boundsA.Dx(); x++ {
+				delta := pixelDelta(
+					imgA.At(boundsA.Min.X+x, boundsA.Min.Y+y).RGBA,
+					imgB.At(boundsB.Min.X+x, boundsB.Min.Y+y).RGBA,
+				)
+				if delta > maxDelta {
+					maxDelta = delta
+				}
+				if delta > limit {
+					differ++
+				}
+			}
+		}
+		if differ == 0 {
+			return true, ""
+		}
+		return false, fmt.Sprintf("%d pixels differ, max delta %d", differ, maxDelta)
+	}
+}
+
+// pixelDelta returns the largest difference between the 8 bit color channels
+// of the two given pixels.
+func pixelDelta(a, b func() (r, g, b, a uint32)) int {
+	r1, g1, b1, a1 := a()
+	r2, g2, b2, a2 := b()
+	var max int
+	for _, c := range [][2]uint32{{r1, r2}, {g1, g2}, {b1, b2}, {a1, a2}} {
+		delta := int(c[0]>>8) - int(c[1]>>8)
+		if delta < 0 {
+			delta = -delta
+		}
+		if delta > max {
+			max = delta
+		}
+	}
+	return max
+}
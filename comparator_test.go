@@ -0,0 +1,319 @@
+package goldy
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func grayImage(width, height int, set func(x, y int) uint8) image.Image {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.SetGray(x, y, color.Gray{Y: set(x, y)})
+		}
+	}
+	return img
+}
+
+func TestImageComparator(t *testing.T) {
+	base := encodePNG(t, grayImage(10, 10, func(x, y int) uint8 { return 100 }))
+	tests := []struct {
+		Name      string
+		B         []byte
+		Tolerance float64
+		Want      bool
+		Detail    string
+	}{
+		{
+			Name: "identical",
+			B:    base,
+			Want: true,
+		},
+		{
+			Name: "within_tolerance",
+			B: encodePNG(t, grayImage(10, 10, func(x, y int) uint8 {
+				return 100 + uint8(x%2)
+			})),
+			Tolerance: 0.01,
+			Want:      true,
+		},
+		{
+			Name: "pixels_differ",
+			B: encodePNG(t, grayImage(10, 10, func(x, y int) uint8 {
+				if y == 0 {
+					return 130
+				}
+				return 100
+			})),
+			Tolerance: 0.01,
+			Detail:    "10 pixels differ, max delta 30",
+		},
+		{
+			Name:   "dimensions",
+			B:      encodePNG(t, grayImage(10, 5, func(x, y int) uint8 { return 100 })),
+			Detail: "dimensions differ: 10x10 -> 10x5",
+		},
+		{
+			Name:   "not_an_image",
+			B:      []byte("hello"),
+			Detail: "failed to decode image: image: unknown format",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			equal, detail := ImageComparator(test.Tolerance)(base, test.B)
+			if equal != test.Want || detail != test.Detail {
+				t.Fatalf("got=%v %q want=%v %q", equal, detail, test.Want, test.Detail)
+			}
+		})
+	}
+}
+
+func TestGoldenFixturesComparators(t *testing.T) {
+	tmpDir := testDir(t)
+	golden := encodePNG(t, grayImage(4, 4, func(x, y int) uint8 { return 0 }))
+	if err := ioutil.WriteFile(filepath.Join(tmpDir, "a.png"), golden, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	newGf := func() *GoldenFixtures {
+		gf := gc.GoldenFixtures()
+		gf.Dir = tmpDir
+		gf.Flags = ""
+		gf.Comparators = map[string]Comparator{".png": ImageComparator(0)}
+		return gf
+	}
+
+	// Same pixels, but a different encoding.
+	reencoded := &bytes.Buffer{}
+	enc := png.Encoder{CompressionLevel: png.NoCompression}
+	if err := enc.Encode(reencoded, grayImage(4, 4, func(x, y int) uint8 { return 0 })); err != nil {
+		t.Fatal(err)
+	} else if bytes.Equal(reencoded.Bytes(), golden) {
+		t.Fatal("re-encoded image should differ byte-for-byte")
+	}
+	gf := newGf()
+	gf.Add(reencoded.Bytes(), "a.png")
+	if err := gf.Test(); err != nil {
+		t.Fatalf("got err=%v want=nil", err)
+	}
+
+	gf = newGf()
+	gf.Add(encodePNG(t, grayImage(4, 4, func(x, y int) uint8 { return uint8(x) })), "a.png")
+	want := "1 errors:\nchanged file: " + filepath.Join(tmpDir, "a.png") + " (12 pixels differ, max delta 3)"
+	if err := gf.Test(); err == nil || !strings.HasPrefix(err.Error(), want) {
+		t.Fatalf("got err=%v want=%v", err, want)
+	}
+}
+
+func TestSortedLinesComparator(t *testing.T) {
+	tests := []struct {
+		A      string
+		B      string
+		Want   bool
+		Detail string
+	}{
+		{A: "a\nb\nc\n", B: "c\na\nb\n", Want: true},
+		{A: "a\nb\nc\n", B: "b\nc\na", Want: true},
+		{A: "a\na\nb\n", B: "a\nb\na\n", Want: true},
+		{A: "", B: "", Want: true},
+		{A: "a\na\nb\n", B: "a\nb\nb\n", Detail: "@@ -1,3 +1,3 @@\n-a\n a\n b\n+b"},
+		{A: "b\na\n", B: "c\na\n", Detail: "@@ -1,2 +1,2 @@\n a\n-b\n+c"},
+	}
+	for i, test := range tests {
+		equal, detail := SortedLinesComparator()([]byte(test.A), []byte(test.B))
+		if equal != test.Want || detail != test.Detail {
+			t.Errorf("%d: got=%v %q want=%v %q", i, equal, detail, test.Want, test.Detail)
+		}
+	}
+}
+
+func TestGoldenFixturesSortedLines(t *testing.T) {
+	tmpDir := testDir(t)
+	newGf := func(flags string, data string) *GoldenFixtures {
+		gf := gc.GoldenFixtures()
+		gf.Dir = tmpDir
+		gf.Flags = flags
+		gf.Comparators = map[string]Comparator{".txt": SortedLinesComparator()}
+		gf.Transform = func(path string, data []byte) []byte {
+			return SortLines(data)
+		}
+		gf.Add([]byte(data), "a.txt")
+		return gf
+	}
+	if err := newGf(string(FlagUpdate), "c\nb\na\n").Test(); err != nil {
+		t.Fatal(err)
+	} else if data, err := ioutil.ReadFile(filepath.Join(tmpDir, "a.txt")); err != nil {
+		t.Fatal(err)
+	} else if want := "a\nb\nc\n"; string(data) != want {
+		t.Fatalf("got=%q want=%q", data, want)
+	} else if err := newGf("", "b\na\nc\n").Test(); err != nil {
+		t.Fatalf("got err=%v want=nil", err)
+	}
+
+	// MaxDiffLines applies to the detail as well.
+	gf := newGf("", "a\nb\nd\n")
+	gf.MaxDiffLines = 2
+	want := "changed file: " + filepath.Join(tmpDir, "a.txt") + "\n  @@ -1,3 +1,3 @@\n   a\n  ... (3 more lines)\n"
+	if err := gf.Test(); err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("got err=%v want=%q", err, want)
+	}
+}
+
+func TestIgnoreBytes(t *testing.T) {
+	// A header with a magic number, a 4 byte timestamp and a body.
+	golden := []byte("BIN\x00\x01\x02\x03\x04body\x00")
+	cmp := IgnoreBytes([2]int{4, 8})
+	tests := []struct {
+		Data       string
+		WantEqual  bool
+		WantDetail string
+	}{
+		{Data: "BIN\x00\x01\x02\x03\x04body\x00", WantEqual: true},
+		{Data: "BIN\x00\x09\x09\x09\x09body\x00", WantEqual: true},
+		{Data: "BIN\x00\x09\x09\x09\x09bodY\x00", WantDetail: "13 -> 13 bytes, 1 bytes differ"},
+		{Data: "BIN\x00\x09", WantDetail: "13 -> 5 bytes, 8 bytes differ"},
+		{Data: "BIX\x00\x01\x02\x03\x04body\x00", WantDetail: "13 -> 13 bytes, 1 bytes differ"},
+	}
+	for i, test := range tests {
+		equal, detail := cmp(golden, []byte(test.Data))
+		if equal != test.WantEqual || detail != test.WantDetail {
+			t.Errorf("%d: got=%v %q want=%v %q", i, equal, detail, test.WantEqual, test.WantDetail)
+		}
+	}
+	if got := golden[4]; got != 0x01 {
+		t.Errorf("got=%d want=%d", got, 0x01)
+	}
+
+	masked := MaskBytes([]byte("abcdef"), [2]int{-1, 1}, [2]int{4, 10})
+	if want := "\x00bcd\x00\x00"; string(masked) != want {
+		t.Errorf("got=%q want=%q", masked, want)
+	}
+}
+
+func TestGoldenFixturesIgnoreBytes(t *testing.T) {
+	tmpDir := testDir(t)
+	header := [2]int{0, 4}
+	newGf := func(flags string, stamp string) *GoldenFixtures {
+		gf := gc.GoldenFixtures()
+		gf.Dir = tmpDir
+		gf.Flags = flags
+		gf.Comparators = map[string]Comparator{".bin": IgnoreBytes(header)}
+		gf.Transform = func(path string, data []byte) []byte {
+			return MaskBytes(data, header)
+		}
+		gf.Add([]byte(stamp+"\x00data"), "a.bin")
+		return gf
+	}
+	if err := newGf(string(FlagUpdate), "1234").Test(); err != nil {
+		t.Fatal(err)
+	} else if data, err := ioutil.ReadFile(filepath.Join(tmpDir, "a.bin")); err != nil {
+		t.Fatal(err)
+	} else if want := "\x00\x00\x00\x00\x00data"; string(data) != want {
+		t.Fatalf("got=%q want=%q", data, want)
+	} else if err := newGf("", "5678").Test(); err != nil {
+		t.Fatalf("got err=%v want=nil", err)
+	}
+}
+
+func TestJSONComparator(t *testing.T) {
+	tests := []struct {
+		A      string
+		B      string
+		Want   bool
+		Detail string
+	}{
+		{A: `{"a":1,"b":[1,2]}`, B: "{\n  \"b\": [1, 2],\n  \"a\": 1\n}\n", Want: true},
+		{A: `{"a":{"x":true,"y":null}}`, B: `{"a":{"y":null,"x":true}}`, Want: true},
+		{A: `[1,2]`, B: `[2,1]`, Detail: "@@ -1,4 +1,4 @@\n [\n-  1,\n-  2\n+  2,\n+  1\n ]"},
+		{A: `{"b":1,"a":1}`, B: `{"a":2,"b":1}`, Detail: "@@ -1,4 +1,4 @@\n {\n-  \"a\": 1,\n+  \"a\": 2,\n   \"b\": 1\n }"},
+		{A: `{"a":1.0,"b":1e3}`, B: `{"a":1,"b":1000}`, Want: true},
+		{A: `{"id":9007199254740993}`, B: `{"id":9007199254740992}`, Detail: "@@ -1,3 +1,3 @@\n {\n-  \"id\": 9007199254740993\n+  \"id\": 9007199254740992\n }"},
+		{A: `{}`, B: `{`, Detail: "failed to decode JSON: unexpected end of JSON input"},
+		{A: `x`, B: `{}`, Detail: "failed to decode golden JSON: invalid character 'x' looking for beginning of value"},
+	}
+	for i, test := range tests {
+		equal, detail := JSONComparator()([]byte(test.A), []byte(test.B))
+		if equal != test.Want || detail != test.Detail {
+			t.Errorf("%d: got=%v %q want=%v %q", i, equal, detail, test.Want, test.Detail)
+		}
+	}
+}
+
+// unmarshalFlatYAML is a minimal stand-in for a YAML library that decodes
+// documents consisting only of "key: value" lines into a
+// map[interface{}]interface{} like gopkg.in/yaml.v2 does.
+func unmarshalFlatYAML(data []byte, v interface{}) error {
+	m := map[interface{}]interface{}{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("bad line: %q", line)
+		}
+		m[strings.TrimSpace(parts[0])] = strings.Trim(strings.TrimSpace(parts[1]), `"'`)
+	}
+	*(v.(*interface{})) = m
+	return nil
+}
+
+func TestYAMLComparator(t *testing.T) {
+	tests := []struct {
+		A      string
+		B      string
+		Want   bool
+		Detail string
+	}{
+		{A: "a: 1\nb: x\n", B: "# comment\nb: \"x\"\na: 1\n", Want: true},
+		{A: "a: 1\nb: x\n", B: "b: 'x'\na: 1", Want: true},
+		{A: "b: x\na: 1\n", B: "a: 2\nb: x\n", Detail: "@@ -1,4 +1,4 @@\n {\n-  \"a\": \"1\",\n+  \"a\": \"2\",\n   \"b\": \"x\"\n }"},
+		{A: "a: 1", B: "a", Detail: `failed to decode YAML: bad line: "a"`},
+		{A: "a", B: "a: 1", Detail: `failed to decode golden YAML: bad line: "a"`},
+	}
+	for i, test := range tests {
+		equal, detail := YAMLComparator(unmarshalFlatYAML)([]byte(test.A), []byte(test.B))
+		if equal != test.Want || detail != test.Detail {
+			t.Errorf("%d: got=%v %q want=%v %q", i, equal, detail, test.Want, test.Detail)
+		}
+	}
+}
+
+func TestGoldenFixturesJSONComparator(t *testing.T) {
+	tmpDir := testDir(t)
+	if err := ioutil.WriteFile(filepath.Join(tmpDir, "a.json"), []byte(`{"a":1,"b":2}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	gf := gc.GoldenFixtures()
+	gf.Dir = tmpDir
+	gf.Flags = ""
+	gf.Comparators = map[string]Comparator{".json": JSONComparator()}
+	gf.Add([]byte(`{"b":2,"a":1}`), "a.json")
+	if err := gf.Test(); err != nil {
+		t.Fatalf("got err=%v want=nil", err)
+	}
+
+	gf.Fixtures = Fixtures{}
+	gf.Add([]byte(`{"b":3,"a":1}`), "a.json")
+	want := "1 errors:\nchanged file: " + filepath.Join(tmpDir, "a.json") + "\n  @@ -1,4 +1,4 @@\n   {\n     \"a\": 1,\n  -  \"b\": 2\n  +  \"b\": 3\n   }\n"
+	if err := gf.Test(); err == nil || !strings.HasPrefix(err.Error(), want) {
+		t.Fatalf("got err=%v want=%v", err, want)
+	}
+}
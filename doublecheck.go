@@ -0,0 +1,52 @@
+package goldy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrNonDeterministic is wrapped by the error returned from
+// GoldenFixtures.Test if DoubleCheck is set and a func passed to AddFunc
+// produced different data when called twice. Unlike a regular diff, this
+// indicates a bug in the code generating the fixture, e.g. map iteration
+// order leaking into its output, so updating the golden fixtures won't help.
+var ErrNonDeterministic = errors.New("non-deterministic fixtures")
+
+// AddFunc is like Add, but calls fn to produce the data. If gf.DoubleCheck is
+// set, Test calls fn a second time when comparing the golden fixtures and
+// fails if both calls returned different data.
+func (gf *GoldenFixtures) AddFunc(fn func() []byte, path ...string) {
+	gf.Add(fn(), path...)
+	if gf.funcs == nil {
+		gf.funcs = map[string]func() []byte{}
+	}
+	gf.funcs[gf.join(path...)] = fn
+}
+
+// doubleCheck implements DoubleCheck by calling every func passed to AddFunc
+// again and returning an error wrapping ErrNonDeterministic if its data
+// differs from the data it returned before.
+func (gf *GoldenFixtures) doubleCheck() error {
+	if !gf.DoubleCheck {
+		return nil
+	}
+	var errs []string
+	for path, fn := range gf.funcs {
+		if data := fn(); !bytes.Equal(data, gf.Fixtures[path]) {
+			errs = append(errs, fmt.Sprintf("%s %s", path, binarySummary(gf.Fixtures[path], data)))
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	sort.Strings(errs)
+	return fmt.Errorf(
+		"%w: %d fixtures changed when generated twice:\n%s\n\nmake the code producing the fixtures above deterministic",
+		ErrNonDeterministic,
+		len(errs),
+		strings.Join(errs, "\n"),
+	)
+}
@@ -0,0 +1,56 @@
+package goldy
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestGoldenFixturesDoubleCheck(t *testing.T) {
+	c := TempConfig(t)
+	c.DoubleCheck = true
+	deterministic := func() []byte { return []byte("a") }
+	var calls int
+	flaky := func() []byte {
+		calls++
+		return []byte(fmt.Sprintf("call %d", calls))
+	}
+
+	gf := c.GoldenFixtures("out")
+	gf.Flags = string(FlagUpdate)
+	gf.AddFunc(deterministic, "a.txt")
+	gf.AddFunc(flaky, "b.txt")
+	if err := gf.Test(); err != nil {
+		t.Fatal(err)
+	} else if calls != 1 {
+		t.Fatalf("got=%d want=%d", calls, 1)
+	}
+
+	// The golden fixture matches the first call, so only the non-determinism
+	// is reported.
+	calls = 0
+	gf = c.GoldenFixtures("out")
+	gf.AddFunc(deterministic, "a.txt")
+	gf.AddFunc(flaky, "b.txt")
+	err := gf.Test()
+	if !errors.Is(err, ErrNonDeterministic) {
+		t.Fatalf("got=%v want=%v", err, ErrNonDeterministic)
+	}
+	want := "non-deterministic fixtures: 1 fixtures changed when generated twice:\n" +
+		gf.Dir + "/b.txt (6 -> 6 bytes, 1 bytes differ)\n\n" +
+		"make the code producing the fixtures above deterministic"
+	if err.Error() != want {
+		t.Fatalf("got=%q want=%q", err, want)
+	}
+
+	calls = 0
+	gf = c.GoldenFixtures("out")
+	gf.DoubleCheck = false
+	gf.AddFunc(deterministic, "a.txt")
+	gf.AddFunc(flaky, "b.txt")
+	if err := gf.Test(); err != nil {
+		t.Fatal(err)
+	} else if calls != 1 {
+		t.Fatalf("got=%d want=%d", calls, 1)
+	}
+}
@@ -6,13 +6,23 @@ import (
 	"fmt"
 	"image/jpeg"
 	"image/png"
+	"io"
 	"path/filepath"
 	"testing"
 
 	"github.com/felixge/goldy"
 )
 
-var gc = goldy.DefaultConfig()
+var gc = func() goldy.Config {
+	c := goldy.DefaultConfig()
+	// Compare pixels rather than bytes so encoder changes don't break tests.
+	// The red-only outputs tolerate small jpeg decoder differences.
+	c.Comparators = map[string]goldy.Comparator{
+		".png": goldy.ImageComparator(0),
+		".jpg": goldy.ImageComparator(0.02),
+	}
+	return c
+}()
 
 func TestMarshalIndent(t *testing.T) {
 	tests := []struct {
@@ -49,10 +59,12 @@ func TestGradient(t *testing.T) {
 
 	gf := gc.GoldenFixtures("out", "gradient")
 	for _, test := range tests {
-		b := &bytes.Buffer{}
-		png.Encode(b, Gradient(test.Width, test.Height))
 		name := fmt.Sprintf("%dx%x.png", test.Width, test.Height)
-		gf.Add(b.Bytes(), name)
+		if err := gf.Capture(func(w io.Writer) error {
+			return png.Encode(w, Gradient(test.Width, test.Height))
+		}, name); err != nil {
+			t.Fatal(err)
+		}
 	}
 	if err := gf.Test(); err != nil {
 		t.Fatal(err)
@@ -70,11 +82,37 @@ func TestRedOnly(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
-		b := &bytes.Buffer{}
-		png.Encode(b, RedOnly(img))
-		out.Add(b.Bytes(), filepath.Base(path))
+		if err := out.Capture(func(w io.Writer) error {
+			return png.Encode(w, RedOnly(img))
+		}, filepath.Base(path)); err != nil {
+			t.Fatal(err)
+		}
 	}
 	if err := out.Test(); err != nil {
 		t.Fatal(err)
 	}
 }
+
+func TestGradientReencoded(t *testing.T) {
+	cmp := goldy.ImageComparator(0)
+	img := Gradient(100, 50)
+	a, b := &bytes.Buffer{}, &bytes.Buffer{}
+	if err := png.Encode(a, img); err != nil {
+		t.Fatal(err)
+	}
+	enc := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := enc.Encode(b, img); err != nil {
+		t.Fatal(err)
+	}
+	if equal, detail := cmp(a.Bytes(), b.Bytes()); !equal {
+		t.Fatalf("got=%v want=true: %s", equal, detail)
+	}
+
+	b.Reset()
+	if err := png.Encode(b, RedOnly(img)); err != nil {
+		t.Fatal(err)
+	}
+	if equal, _ := cmp(a.Bytes(), b.Bytes()); equal {
+		t.Fatalf("got=%v want=false", equal)
+	}
+}
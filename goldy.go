@@ -2,13 +2,27 @@ package goldy
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"runtime"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
 
 	"github.com/pmezard/go-difflib/difflib"
 )
@@ -19,8 +33,51 @@ const (
 	// FlagUpdate causes goldy to update any modified or missing fixtures and
 	// to delete any fixtures that were removed.
 	FlagUpdate Flag = "update"
-	// FlagDiff causes goldly to print a diff for mismatching fixtures.
+	// FlagDiff causes goldly to print a diff for mismatching fixtures. Without
+	// it, only fixtures within GoldenFixtures.AutoDiffLimit get a diff.
 	FlagDiff Flag = "diff"
+	// FlagJSON causes goldy to print mismatching fixtures as a JSON array to
+	// stdout, see Diff.MarshalJSON.
+	FlagJSON Flag = "json"
+	// FlagVerbose causes goldy to include more details in its output, e.g. the
+	// file contents for FlagJSON. Test also prints every compared path and
+	// whether it matched to stderr, even if all of them do.
+	FlagVerbose Flag = "verbose"
+	// FlagColor causes goldy to colorize the diffs printed for FlagDiff if
+	// stdout is a terminal and the NO_COLOR env variable is not set.
+	FlagColor Flag = "color"
+	// FlagDryRun causes FlagUpdate, FlagRewrite and FlagClean to return an
+	// error describing the files they would create, overwrite or delete
+	// instead of modifying them.
+	FlagDryRun Flag = "dry-run"
+	// FlagFailIfUpdated causes FlagUpdate and FlagRewrite to return an error
+	// after updating any golden fixtures. This is useful on CI to detect
+	// stale fixtures.
+	FlagFailIfUpdated Flag = "fail-if-updated"
+	// FlagQuiet causes goldy to report mismatching fixtures as a single line
+	// summary without listing them individually.
+	FlagQuiet Flag = "quiet"
+	// FlagRewrite is a stronger FlagUpdate. It removes all files in the golden
+	// fixture dir that are not excluded before writing all golden fixtures
+	// from scratch, regardless of IgnoreUnexpected.
+	FlagRewrite Flag = "rewrite"
+	// FlagStats causes Test to print the number of fixtures, the total number
+	// of bytes compared and the time spent loading and comparing them to
+	// stderr.
+	FlagStats Flag = "stats"
+	// FlagInteractive causes Test to print every difference and prompt on
+	// stdin whether to accept it. Accepted changes are applied like
+	// FlagUpdate, rejected ones are reported as usual. It fails if stdin is
+	// not a terminal.
+	FlagInteractive Flag = "interactive"
+	// FlagClean causes Test to delete unexpected golden fixtures, i.e. files
+	// no longer produced by the test, without writing anything. Changed and
+	// missing fixtures are still reported as usual. It has no effect if
+	// IgnoreUnexpected is set.
+	FlagClean Flag = "clean"
+	// FlagForce allows FlagUpdate and FlagClean to modify more files than
+	// GoldenFixtures.ConfirmThreshold.
+	FlagForce Flag = "force"
 )
 
 func parseFlags(flags string) (map[Flag]bool, error) {
@@ -30,7 +87,8 @@ func parseFlags(flags string) (map[Flag]bool, error) {
 	}
 	for _, flag := range strings.Split(flags, ",") {
 		switch f := Flag(flag); f {
-		case FlagUpdate, FlagDiff:
+		case FlagUpdate, FlagDiff, FlagJSON, FlagVerbose, FlagColor, FlagDryRun,
+			FlagFailIfUpdated, FlagQuiet, FlagRewrite, FlagStats, FlagInteractive, FlagClean, FlagForce:
 			r[f] = true
 		default:
 			return nil, fmt.Errorf("unknown flag: %q", flag)
@@ -39,9 +97,27 @@ func parseFlags(flags string) (map[Flag]bool, error) {
 	return r, nil
 }
 
+var (
+	// stderr is where goldy logs messages that are not part of a returned
+	// error.
+	stderr io.Writer = os.Stderr
+	// stdout is where goldy prints machine-readable output, see FlagJSON.
+	stdout io.Writer = os.Stdout
+)
+
 const (
 	// DefaultEnvName is the environment variable name used by DefaultConfig.
 	DefaultEnvName = "GOLDY"
+	// DefaultAutoDiffLimit is the AutoDiffLimit used by EnvConfig and
+	// FlagConfig.
+	DefaultAutoDiffLimit = 2048
+	// DefaultDiffContext is the DiffContext used by EnvConfig and FlagConfig.
+	DefaultDiffContext = 3
+
+	// defaultFileMode and defaultDirMode are used for writing golden fixtures
+	// if no other mode is configured.
+	defaultFileMode os.FileMode = 0600
+	defaultDirMode  os.FileMode = 0700
 )
 
 // DefaultConfig is a wrapper for EnvConfig(DefaultEnvName). It is the
@@ -53,11 +129,18 @@ func DefaultConfig() Config {
 
 // EnvConfig returns a new Config that uses the env variable with the given
 // name name to determine if golden fixtures should be updated or compared
-// when calling Test on them.
+// when calling Test on them. The env variable name + "_ONLY" is used to
+// populate Config.Only, and name + "_DIR", if set, replaces the default
+// Config.Dir. Setting Dir on the returned Config takes precedence.
 func EnvConfig(name string) Config {
 	return Config{
-		Flags: os.Getenv(name),
-		Hint:  name + "=update go test",
+		Dir:           os.Getenv(name + "_DIR"),
+		Flags:         os.Getenv(name),
+		Hint:          name + "=update go test",
+		DiffHint:      name + "=diff go test",
+		Only:          os.Getenv(name + "_ONLY"),
+		AutoDiffLimit: DefaultAutoDiffLimit,
+		DiffContext:   DefaultDiffContext,
 	}.WithDefaults()
 }
 
@@ -67,11 +150,68 @@ func EnvConfig(name string) Config {
 // author's hate for dogma exceeds his hate for global state. That being said,
 // he'll still shake his head if you end up using this method.
 func FlagConfig(name string) *Config {
-	c := (Config{Hint: "go test -" + name}).WithDefaults()
-	flag.StringVar(&c.Flags, name, "", "Goldy flags: update, diff")
+	c := (Config{
+		Hint:          "go test -" + name,
+		DiffHint:      "go test -" + name + "=diff",
+		AutoDiffLimit: DefaultAutoDiffLimit,
+		DiffContext:   DefaultDiffContext,
+	}).WithDefaults()
+	flag.StringVar(&c.Flags, name, "", "Goldy flags: update, diff, json, verbose, color, dry-run, fail-if-updated, quiet, rewrite, stats, interactive, clean, force")
 	return &c
 }
 
+// BoolFlagConfig is like FlagConfig, but registers a bool flag with the given
+// name that enables FlagUpdate, e.g. `go test -update`. This matches the
+// convention used by many Go projects.
+func BoolFlagConfig(name string) *Config {
+	c := (Config{
+		Hint:          "go test -" + name,
+		AutoDiffLimit: DefaultAutoDiffLimit,
+		DiffContext:   DefaultDiffContext,
+	}).WithDefaults()
+	flag.Var(&updateFlag{flags: &c.Flags}, name, "Update golden fixtures")
+	return &c
+}
+
+// TempConfig returns a new Config with its Dir set to a temporary directory
+// created via t.TempDir, which is removed when t and all its subtests
+// complete. This is useful for tests that operate on golden fixtures
+// themselves. Flags are not read from the environment.
+func TempConfig(t testing.TB) Config {
+	t.Helper()
+	return Config{
+		Dir:           t.TempDir(),
+		AutoDiffLimit: DefaultAutoDiffLimit,
+		DiffContext:   DefaultDiffContext,
+	}.WithDefaults()
+}
+
+// updateFlag is a bool flag.Value that sets *flags to FlagUpdate when true.
+type updateFlag struct {
+	flags *string
+}
+
+func (f *updateFlag) IsBoolFlag() bool { return true }
+
+func (f *updateFlag) String() string {
+	if f.flags == nil {
+		return "false"
+	}
+	return strconv.FormatBool(*f.flags == string(FlagUpdate))
+}
+
+func (f *updateFlag) Set(value string) error {
+	update, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	} else if update {
+		*f.flags = string(FlagUpdate)
+	} else {
+		*f.flags = ""
+	}
+	return nil
+}
+
 // Config allows you to customize your goldy integration. You're probably
 // better off using DefaultConfig() instead.
 type Config struct {
@@ -84,12 +224,115 @@ type Config struct {
 	// Hint is a message displayed when golden fixtures fail comparison. It's
 	// intended to tell the user how to automatically update the fixtures.
 	Hint string
+	// DiffHint is inherited by all GoldenFixtures created from this Config.
+	DiffHint string
 	// IgnoreUnexpected is inherited by all GoldenFixtures created from this
 	// Config.
 	IgnoreUnexpected bool
 	// Exclude is called for every file when loading input or golden fixtures and
 	// allows to exclude it by returning false. Set to IsDotfile by WithDefaults.
 	Exclude func(path string) bool
+	// ExcludeInfo is like Exclude, but also receives the os.FileInfo of the
+	// file. A file is excluded if either Exclude or ExcludeInfo excludes it.
+	ExcludeInfo func(path string, info os.FileInfo) bool
+	// ExcludeContent is like Exclude, but is called with the content of the
+	// file after reading it, e.g. ExcludeEmpty. It is also inherited by all
+	// GoldenFixtures created from this Config.
+	ExcludeContent func(path string, data []byte) bool
+	// FollowSymlinks causes symlinks to directories to be followed when
+	// loading input fixtures. Symlinks to files are always loaded with the
+	// content of their target. It is also inherited by all GoldenFixtures
+	// created from this Config.
+	FollowSymlinks bool
+	// KeepEmptyDirs is inherited by all GoldenFixtures created from this
+	// Config.
+	KeepEmptyDirs bool
+	// Archive is inherited by all GoldenFixtures created from this Config.
+	Archive bool
+	// Store is inherited by all GoldenFixtures created from this Config.
+	Store FixtureStore
+	// Transform is inherited by all GoldenFixtures created from this Config.
+	Transform func(path string, data []byte) []byte
+	// Compress is inherited by all GoldenFixtures created from this Config.
+	Compress bool
+	// EncodeBinary is inherited by all GoldenFixtures created from this
+	// Config.
+	EncodeBinary bool
+	// Only is inherited by all GoldenFixtures created from this Config.
+	Only string
+	// Comparators is inherited by all GoldenFixtures created from this Config.
+	Comparators map[string]Comparator
+	// FileMode is inherited by all GoldenFixtures created from this Config. Set
+	// to 0600 by WithDefaults.
+	FileMode os.FileMode
+	// DirMode is inherited by all GoldenFixtures created from this Config. Set
+	// to 0700 by WithDefaults.
+	DirMode os.FileMode
+	// AutoDiffLimit is inherited by all GoldenFixtures created from this
+	// Config. Set to DefaultAutoDiffLimit by EnvConfig and FlagConfig.
+	AutoDiffLimit int
+	// DiffContext is inherited by all GoldenFixtures created from this
+	// Config. Set to DefaultDiffContext by EnvConfig and FlagConfig.
+	DiffContext int
+	// OnMismatch is inherited by all GoldenFixtures created from this Config.
+	OnMismatch func(diff Diff)
+	// StreamThreshold is inherited by all GoldenFixtures created from this
+	// Config.
+	StreamThreshold int64
+	// Session is inherited by all GoldenFixtures created from this Config. See
+	// NewSession.
+	Session *Session
+	// ReadRetries is the number of times reading an input or golden fixture is
+	// retried after a transient error such as EAGAIN or EBUSY, with an
+	// exponential backoff starting at 10ms. It is inherited by all
+	// GoldenFixtures created from this Config.
+	ReadRetries int
+	// Logf, if not nil, is used to log which files are excluded or loaded when
+	// loading input fixtures. It is inherited by all GoldenFixtures created
+	// from this Config.
+	Logf func(format string, args ...interface{})
+	// MaxDiffLines is inherited by all GoldenFixtures created from this
+	// Config.
+	MaxDiffLines int
+	// AutoCreate is inherited by all GoldenFixtures created from this Config.
+	AutoCreate bool
+	// VerifyChecksums is inherited by all GoldenFixtures created from this
+	// Config.
+	VerifyChecksums bool
+	// IgnoreTrailingWhitespace is inherited by all GoldenFixtures created from
+	// this Config.
+	IgnoreTrailingWhitespace bool
+	// IgnorePatterns is inherited by all GoldenFixtures created from this
+	// Config.
+	IgnorePatterns []*regexp.Regexp
+	// FailOnEmpty is inherited by all GoldenFixtures created from this Config.
+	FailOnEmpty bool
+	// MaxFixtureSize limits the size of input fixtures loaded by
+	// InputFixtures. It is also inherited by all GoldenFixtures created from
+	// this Config.
+	MaxFixtureSize int64
+	// Reference is inherited by all GoldenFixtures created from this Config.
+	Reference func(path string) ([]byte, error)
+	// Encoder is used by GoldenValue to encode values. Defaults to
+	// JSONEncoder if nil.
+	Encoder func(v interface{}) ([]byte, error)
+	// AutoExt is the extension appended to the paths derived by GoldenAuto.
+	// Defaults to ".golden" if empty.
+	AutoExt string
+	// DoubleCheck is inherited by all GoldenFixtures created from this Config.
+	DoubleCheck bool
+	// DisplayDir is inherited by all GoldenFixtures created from this Config.
+	DisplayDir string
+	// OnUpdate is inherited by all GoldenFixtures created from this Config.
+	OnUpdate func(written []string) error
+	// ConfirmThreshold is inherited by all GoldenFixtures created from this
+	// Config.
+	ConfirmThreshold int
+	// ArtifactsDir is inherited by all GoldenFixtures created from this
+	// Config.
+	ArtifactsDir string
+	// Output is inherited by all GoldenFixtures created from this Config.
+	Output io.Writer
 }
 
 // WithDefaults returns a a copy of c that replaces zero values with default
@@ -101,19 +344,90 @@ func (c Config) WithDefaults() Config {
 	if c.Exclude == nil {
 		c.Exclude = IsDotfile
 	}
+	if c.FileMode == 0 {
+		c.FileMode = defaultFileMode
+	}
+	if c.DirMode == 0 {
+		c.DirMode = defaultDirMode
+	}
+	return c
+}
+
+// WithDir returns a copy of c with Dir set to dir.
+func (c Config) WithDir(dir string) Config {
+	c.Dir = dir
+	return c
+}
+
+// WithFlags returns a copy of c with Flags set to flags.
+func (c Config) WithFlags(flags string) Config {
+	c.Flags = flags
+	return c
+}
+
+// WithHint returns a copy of c with Hint set to hint.
+func (c Config) WithHint(hint string) Config {
+	c.Hint = hint
+	return c
+}
+
+// WithIgnoreUnexpected returns a copy of c with IgnoreUnexpected set to
+// ignore.
+func (c Config) WithIgnoreUnexpected(ignore bool) Config {
+	c.IgnoreUnexpected = ignore
 	return c
 }
 
 // GoldenFixtures returns a new GoldenFixtures instance pointing to the given
 // path inside c.Dir.
 func (c Config) GoldenFixtures(path ...string) *GoldenFixtures {
+	exclude := c.Exclude
+	if exclude == nil {
+		exclude = IsDotfile
+	}
 	return &GoldenFixtures{
 		Dir:              filepath.Join(append([]string{c.Dir}, path...)...),
 		Fixtures:         Fixtures{},
 		Flags:            c.Flags,
 		Hint:             c.Hint,
+		DiffHint:         c.DiffHint,
 		IgnoreUnexpected: c.IgnoreUnexpected,
-		Exclude:          IsDotfile,
+		Exclude:          exclude,
+		ExcludeInfo:      c.ExcludeInfo,
+		ExcludeContent:   c.ExcludeContent,
+		FollowSymlinks:   c.FollowSymlinks,
+		KeepEmptyDirs:    c.KeepEmptyDirs,
+		Archive:          c.Archive,
+		Store:            c.Store,
+		Transform:        c.Transform,
+		Compress:         c.Compress,
+		Only:             c.Only,
+		Comparators:      c.Comparators,
+		FileMode:         c.FileMode,
+		DirMode:          c.DirMode,
+		AutoDiffLimit:    c.AutoDiffLimit,
+		DiffContext:      c.DiffContext,
+		OnMismatch:       c.OnMismatch,
+		StreamThreshold:  c.StreamThreshold,
+		Session:          c.Session,
+		ReadRetries:      c.ReadRetries,
+		Logf:             c.Logf,
+		MaxDiffLines:     c.MaxDiffLines,
+		AutoCreate:       c.AutoCreate,
+		VerifyChecksums:  c.VerifyChecksums,
+
+		IgnoreTrailingWhitespace: c.IgnoreTrailingWhitespace,
+		IgnorePatterns:           c.IgnorePatterns,
+		FailOnEmpty:              c.FailOnEmpty,
+		MaxFixtureSize:           c.MaxFixtureSize,
+		Reference:                c.Reference,
+		DoubleCheck:              c.DoubleCheck,
+		EncodeBinary:             c.EncodeBinary,
+		DisplayDir:               c.DisplayDir,
+		OnUpdate:                 c.OnUpdate,
+		ConfirmThreshold:         c.ConfirmThreshold,
+		ArtifactsDir:             c.ArtifactsDir,
+		Output:                   c.Output,
 	}
 }
 
@@ -126,10 +440,93 @@ func (c Config) GoldenFixture(data []byte, path ...string) error {
 	return gf.Test()
 }
 
+// GoldenStream is like GoldenFixture, but reads the data from r until EOF,
+// e.g. from os.Stdin for a command piping its output into goldy. If reading
+// fails, the golden fixture is neither compared nor updated and the returned
+// error wraps the read error.
+func (c Config) GoldenStream(r io.Reader, path ...string) error {
+	gf := c.GoldenFixtures(path...)
+	gf.IgnoreUnexpected = true
+	if err := gf.AddReader(r); err != nil {
+		return fmt.Errorf("failed to read stream: %w", err)
+	}
+	return gf.Test()
+}
+
+// Golden compares data against the golden fixture at the given path inside
+// c.Dir, or updates it, and fails the test via t.Fatalf if that fails. The
+// error includes c.Hint. This is the simplest way to use goldy:
+//
+//	goldy.DefaultConfig().Golden(t, got, "out", "result.txt")
+func (c Config) Golden(t testing.TB, data []byte, path ...string) {
+	t.Helper()
+	if err := c.GoldenFixture(data, path...); err != nil {
+		t.Fatalf("%s", err)
+	}
+}
+
+// GoldenValue is like Golden, but compares v encoded with c.Encoder. This
+// allows to snapshot arbitrary Go values, e.g.
+//
+//	goldy.DefaultConfig().GoldenValue(t, config, "out", "config.json")
+func (c Config) GoldenValue(t testing.TB, v interface{}, path ...string) {
+	t.Helper()
+	encode := c.Encoder
+	if encode == nil {
+		encode = JSONEncoder
+	}
+	data, err := encode(v)
+	if err != nil {
+		t.Fatalf("failed to encode value: %s", err)
+		return
+	}
+	c.Golden(t, data, path...)
+}
+
+// JSONEncoder encodes v as indented JSON with a trailing newline. It's the
+// default Config.Encoder.
+func JSONEncoder(v interface{}) ([]byte, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// PlatformDir returns base + "-" + runtime.GOOS if a dir with that name
+// exists inside of c.Dir, or base otherwise. This allows to keep separate
+// golden fixtures for platforms whose output legitimately differs, e.g.
+//
+//	gf := gc.GoldenFixtures(gc.PlatformDir("out"))
+//
+// uses "out-darwin" on macOS if it exists, and the shared "out" dir on all
+// other platforms.
+func (c Config) PlatformDir(base string) string {
+	dir := base + "-" + goos
+	if info, err := os.Stat(filepath.Join(c.Dir, dir)); err == nil && info.IsDir() {
+		return dir
+	}
+	return base
+}
+
+// goos is used by PlatformDir. It's a variable so tests can replace it.
+var goos = runtime.GOOS
+
 // InputFixtures loads Fixtures from the given path inside of c.Dir.
 func (c Config) InputFixtures(path ...string) (Fixtures, error) {
 	dir := filepath.Join(append([]string{c.Dir}, path...)...)
-	return Load(dir, c.Exclude)
+	l := &loader{
+		ctx:            context.Background(),
+		exclude:        c.Exclude,
+		excludeInfo:    c.ExcludeInfo,
+		excludeContent: c.ExcludeContent,
+		followSymlinks: c.FollowSymlinks,
+		readRetries:    c.ReadRetries,
+		maxSize:        c.MaxFixtureSize,
+		logf:           c.Logf,
+	}
+	s, _, err := l.load(dir)
+	return s, err
 }
 
 // InputFixture returns the data for the fixture at the given path or an error.
@@ -148,31 +545,300 @@ type GoldenFixtures struct {
 	// Flags controls goldy's behavior.
 	Flags string
 	// Hint is displayed when comparing the in-memory fixtures with those on
-	// disk shows differences.
+	// disk shows differences. Nothing is displayed if it's empty.
 	Hint string
+	// DiffHint, if not empty, is displayed along with Hint if the diff of any
+	// changed text file was not shown. It's intended to tell the user how to
+	// enable FlagDiff, e.g. "GOLDY=diff go test".
+	DiffHint string
 	// IgnoreUnexpected determines if unexpected files found in Dir are ignored
 	// when running Test().
 	IgnoreUnexpected bool
 	// Exclude allows to exclude on-disk files from the comparison/update.
 	Exclude func(path string) bool
+	// ExcludeInfo is like Exclude, but also receives the os.FileInfo of the
+	// file, e.g. to exclude files by size or mode. A file is excluded if
+	// either Exclude or ExcludeInfo excludes it. It is not used for Archive.
+	ExcludeInfo func(path string, info os.FileInfo) bool
+	// ExcludeContent is like Exclude, but is called with the content of
+	// golden fixtures after reading (and decompressing) them. Excluded files
+	// are neither compared nor removed by updates. It is not used for
+	// Archive.
+	ExcludeContent func(path string, data []byte) bool
+	// FollowSymlinks causes symlinks to directories inside of Dir to be
+	// followed when loading the golden fixtures. Loading fails if a symlink
+	// cycle is detected.
+	FollowSymlinks bool
+	// KeepEmptyDirs disables removing directories inside of Dir that become
+	// empty when an update removes unexpected files.
+	KeepEmptyDirs bool
+	// Archive causes the golden fixtures to be stored in a single tar file
+	// named Dir + ".tar" instead of the directory Dir. Update rewrites the
+	// archive atomically. Modes are not supported for archives.
+	Archive bool
+	// Store, if not nil, is used for loading and updating the golden fixtures
+	// of Dir instead of the local file system, e.g. an HTTPStore. Updates
+	// write all golden fixtures of Dir at once like for Archive, which is
+	// ignored if Store is set. Compress, EncodeBinary and Modes are not
+	// supported and cause Test to fail.
+	Store FixtureStore
+	// Transform is applied to every fixture in Fixtures before comparing it
+	// with, or writing it to, the golden fixtures. This allows to normalize
+	// data that changes between runs, e.g. timestamps. Unlike a comparison
+	// option, the transformed data is what gets stored on update.
+	Transform func(path string, data []byte) []byte
+	// Compress causes golden fixtures to be stored gzip compressed with a
+	// ".gz" suffix. When loading, files with a ".gz" suffix are decompressed
+	// and compared without the suffix. The compression is deterministic, so
+	// updating unchanged content produces identical files.
+	Compress bool
+	// EncodeBinary causes binary golden fixtures, i.e. ones containing a NUL
+	// byte, to be stored base64 encoded with a ".b64" suffix, so changes to
+	// them at least show up in line based diffs, e.g. in code review. When
+	// loading, files with a ".b64" suffix are decoded and compared without the
+	// suffix. If Compress is set as well, the compressed data is encoded.
+	EncodeBinary bool
+	// Only restricts the comparison/update to the fixtures whose path relative
+	// to Dir matches the path.Match pattern, which always uses forward slashes
+	// as separators. Other files, in memory or on
+	// disk, are ignored. This is useful for iterating on a single fixture.
+	Only string
+	// Comparators maps file extensions, e.g. ".png", to a Comparator that
+	// decides if changed files with that extension are equal, e.g.
+	// ImageComparator. Files without a Comparator are compared byte-for-byte.
+	Comparators map[string]Comparator
+	// FileMode is the mode used for writing golden fixtures without an entry
+	// in Modes. The zero value means 0600.
+	FileMode os.FileMode
+	// DirMode is the mode used for creating the directories of golden
+	// fixtures. The zero value means 0700.
+	DirMode os.FileMode
+	// AutoDiffLimit is the size in bytes up to which changed text files are
+	// shown with a diff even if FlagDiff is not set. Both versions of the file
+	// must be within the limit. 0 disables this.
+	AutoDiffLimit int
+	// DiffContext is the number of unchanged lines shown around every change
+	// in the diffs of changed files. It must not be negative, and 0 means
+	// DefaultDiffContext. Diffs returned by Comparators always use
+	// DefaultDiffContext.
+	DiffContext int
+	// OnMismatch is called with the diff, including the A and B contents,
+	// whenever Test fails because the golden fixtures don't match. It is not
+	// called when updating. This can be used to persist the failing fixtures,
+	// e.g. as CI artifacts.
+	OnMismatch func(diff Diff)
+	// StreamThreshold is the size in bytes above which golden fixtures on disk
+	// are compared with gf.Fixtures in chunks before loading them. Files that
+	// are equal are never loaded into memory, which reduces memory usage for
+	// very large fixtures. 0 disables this.
+	StreamThreshold int64
+	// Session, if not nil, records gf.Dir and the paths of gf.Fixtures
+	// whenever Diff is called, see Session.Orphans.
+	Session *Session
+	// ReadRetries is the number of times reading a golden fixture is retried
+	// after a transient error. Other errors are returned immediately.
+	ReadRetries int
+	// Logf, if not nil, is used to log diagnostics, i.e. which golden fixtures
+	// are excluded and loaded, the resulting diff, and which files are
+	// written or removed during update.
+	Logf func(format string, args ...interface{})
+	// MaxDiffLines limits the number of lines shown for the diff of a single
+	// file, including multi-line details returned by Comparators. The
+	// remaining lines are replaced by a "... (N more lines)" marker. 0 means
+	// unlimited.
+	MaxDiffLines int
+	// AutoCreate causes Test to write the golden fixtures and pass if Dir, or
+	// the archive file for Archive, does not exist at all. This avoids a
+	// failing first run for new tests. Once Dir exists, the fixtures are
+	// compared as usual, so missing files inside of it are still reported.
+	AutoCreate bool
+	// VerifyChecksums causes the golden fixtures to be checked against a
+	// manifest of their SHA-256 hashes stored next to Dir with a ".sha256"
+	// suffix, see HashManifest. Diff returns an error wrapping
+	// ErrChecksumMismatch if they don't match, unless FlagUpdate is set.
+	// Updates refresh the manifest.
+	VerifyChecksums bool
+	// IgnoreTrailingWhitespace causes text files that only differ in trailing
+	// whitespace at the end of their lines to be considered equal. It only
+	// affects the comparison, updates write the fixtures unmodified.
+	IgnoreTrailingWhitespace bool
+	// IgnorePatterns causes text files that are equal after replacing all
+	// matches of the patterns with a placeholder, see ReplacePatterns, to be
+	// considered equal, e.g. for UUIDs or durations in logs. It only affects
+	// the comparison, use ReplacePatterns with Transform to also store the
+	// placeholders on update.
+	IgnorePatterns []*regexp.Regexp
+	// FailOnEmpty causes Test to fail without comparing or updating anything
+	// if Fixtures is empty, but golden fixtures exist in Dir. This catches
+	// tests that accidentally stopped adding fixtures, e.g. because of a loop
+	// that never runs, even if IgnoreUnexpected is set.
+	FailOnEmpty bool
+	// MaxFixtureSize is the maximum size in bytes of a fixture. If any
+	// fixture in Fixtures or any golden fixture on disk is larger, Diff and
+	// Test return an error without writing anything, and oversized golden
+	// fixtures are not read into memory. 0 means unlimited.
+	MaxFixtureSize int64
+	// Reference, if not nil, is called for every path in Fixtures that has
+	// no golden fixture on disk to produce the expected data instead, e.g. by
+	// running a reference implementation. The results are cached for the
+	// lifetime of gf. It's not called for updates, so they still write the
+	// golden fixtures to disk, which then take precedence.
+	Reference func(path string) ([]byte, error)
+	// DoubleCheck causes Test to call every func passed to AddFunc a second
+	// time before comparing the golden fixtures, and to return an error
+	// wrapping ErrNonDeterministic if it produced different data. It has no
+	// effect if FlagUpdate or FlagRewrite is set.
+	DoubleCheck bool
+	// DisplayDir, if not empty, causes Test to display the paths in its
+	// errors relative to it, e.g. "a.txt" instead of "test-fixtures/out/a.txt"
+	// if it's set to Dir. Paths outside of it are displayed unmodified. This
+	// only affects the messages, Diff and Result still hold the full paths.
+	DisplayDir string
+	// OnUpdate, if not nil, is called after updating the golden fixtures with
+	// the sorted paths of the files that were written, e.g. to format or
+	// optimize them. Files whose content didn't change are not included, and
+	// it's not called if no files were written or Archive or Store is set. If
+	// it returns an error, the update fails.
+	OnUpdate func(written []string) error
+	// ConfirmThreshold, if > 0, is the maximum number of files FlagUpdate,
+	// FlagRewrite or FlagClean may write, delete or chmod at once. Larger
+	// updates fail without modifying anything unless FlagForce is set. This
+	// guards against runaway updates, e.g. from a buggy generator.
+	ConfirmThreshold int
+	// ArtifactsDir, if not empty, causes Test to write the data of changed
+	// and missing fixtures to this dir when they don't match the golden
+	// fixtures, e.g. for downloading them from a failed CI run. The files
+	// mirror the paths of the fixtures, e.g. "test-fixtures/out/a.txt" is
+	// written to ArtifactsDir + "/test-fixtures/out/a.txt". The golden
+	// fixtures themselves are not modified.
+	ArtifactsDir string
+	// Output is where Test writes the messages that are not part of its
+	// returned error, e.g. warnings, the output of FlagVerbose and FlagStats
+	// and the prompts of FlagInteractive. Defaults to os.Stderr if nil. The
+	// JSON printed for FlagJSON always goes to os.Stdout.
+	Output io.Writer
+	// Modes optionally holds the file mode for paths in Fixtures. Paths that
+	// have a mode are written with it on update and report DiffModeChanged if
+	// the mode of the file on disk differs. Paths without a mode are written
+	// with FileMode and their mode is not compared.
+	Modes map[string]os.FileMode
+	// ContentOnlyFailures causes Test to only fail for files whose content
+	// changed. Missing and unexpected files are logged to stderr instead and
+	// can be retrieved via MissingFiles and ExtraFiles after calling Test.
+	ContentOnlyFailures bool
+	// DiffBudget limits the total time spent rendering diffs for FlagDiff
+	// during a single call to Test. Once it is exceeded, the remaining changed
+	// files are reported without a diff. Zero means no limit.
+	DiffBudget time.Duration
+
+	// missing and extra hold the paths reported by MissingFiles and
+	// ExtraFiles.
+	missing []string
+	extra   []string
+	// expected holds the paths passed to Expect.
+	expected []string
+	// allowChanged holds the paths passed to AllowChanged.
+	allowChanged map[string]bool
+	// normalize holds funcs that are applied to golden fixtures loaded from
+	// disk before comparing them, see AddStack.
+	normalize map[string]func([]byte) []byte
+	// added holds the path elements passed to Add for every path.
+	added map[string][]string
+	// references caches the results of Reference by path.
+	references map[string][]byte
+	// funcs holds the funcs passed to AddFunc by path.
+	funcs map[string]func() []byte
+	// mu serializes calls to AddSafe.
+	mu sync.Mutex
+	// stats is collected by Diff for FlagStats.
+	stats struct {
+		fixtures int
+		bytes    int64
+		load     time.Duration
+		compare  time.Duration
+	}
 }
 
 // Add adds a new fixture file with the given path relative to gf.Dir and data
 // for being compared or updated when calling Test.
 func (gf *GoldenFixtures) Add(data []byte, path ...string) {
-	gf.Fixtures.Add(data, append([]string{gf.Dir}, path...)...)
+	key := gf.join(path...)
+	if prev, ok := gf.added[key]; ok {
+		if _, ok := gf.Fixtures[key]; ok {
+			panic(fmt.Sprintf("set already has path: %s (added as %q and %q)", key, prev, path))
+		}
+	}
+	gf.Fixtures.Add(data, key)
+	if gf.added == nil {
+		gf.added = map[string][]string{}
+	}
+	gf.added[key] = path
+}
+
+// AddMode is like Add, but also sets the file mode of the fixture. Only the
+// permission bits of mode are used.
+func (gf *GoldenFixtures) AddMode(data []byte, mode os.FileMode, path ...string) {
+	gf.Add(data, path...)
+	if gf.Modes == nil {
+		gf.Modes = map[string]os.FileMode{}
+	}
+	gf.Modes[gf.join(path...)] = mode.Perm()
+}
+
+// AddReader is like Add, but reads the data from r. If reading fails, no
+// fixture is added and the error is returned.
+func (gf *GoldenFixtures) AddReader(r io.Reader, path ...string) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	gf.Add(data, path...)
+	return nil
+}
+
+// Capture calls fn with a writer and adds the data written to it as a new
+// fixture file with the given path. If fn returns an error, no fixture is
+// added and the error is returned.
+func (gf *GoldenFixtures) Capture(fn func(w io.Writer) error, path ...string) error {
+	buf := &bytes.Buffer{}
+	if err := fn(buf); err != nil {
+		return err
+	}
+	gf.Add(buf.Bytes(), path...)
+	return nil
+}
+
+// join returns the Fixtures key for the given path joined with gf.Dir.
+func (gf *GoldenFixtures) join(path ...string) string {
+	return fixtureKey(filepath.Join(append([]string{gf.Dir}, path...)...))
+}
+
+// only returns true if the given path relative to gf.Dir matches gf.Only.
+func (gf *GoldenFixtures) only(p string) bool {
+	rel, err := filepath.Rel(gf.Dir, filepath.FromSlash(p))
+	ok, _ := path.Match(gf.Only, filepath.ToSlash(rel))
+	return err == nil && ok
 }
 
 // Diff returns the diff between gf.Fixtures and the golden fixtures from
 // gf.Dir or an error.
 func (gf *GoldenFixtures) Diff() (Diff, error) {
-	want, err := Load(gf.Dir, gf.Exclude)
-	if err != nil && !os.IsNotExist(err) {
-		return nil, fmt.Errorf("failed to load golden fixtures: %s", err)
-	}
-	diff := gf.Fixtures.Diff(want)
-	if !gf.IgnoreUnexpected {
-		return diff, nil
+	return gf.filterUnexpected(gf.diff())
+}
+
+// UpdatePlan returns the diff that Test would apply to the golden fixtures in
+// gf.Dir if FlagUpdate was set, regardless of gf.Flags, without modifying
+// anything. Unlike FlagDryRun, the result is structured data that tools can
+// render however they like.
+func (gf *GoldenFixtures) UpdatePlan() (Diff, error) {
+	return gf.filterUnexpected(gf.diffFor(true))
+}
+
+// filterUnexpected returns diff without DiffUnexpected entries if
+// gf.IgnoreUnexpected is set, or err if it's not nil.
+func (gf *GoldenFixtures) filterUnexpected(diff Diff, err error) (Diff, error) {
+	if err != nil || !gf.IgnoreUnexpected {
+		return diff, err
 	}
 	var newDiff Diff
 	for _, d := range diff {
@@ -183,192 +849,1809 @@ func (gf *GoldenFixtures) Diff() (Diff, error) {
 	return newDiff, nil
 }
 
-// Test returns an error if the comparison between gf.Fixtures and the golden
-// fixtures in gf.Dir produced a diff. Or if gf.Flags[FlagUpdate] is true, it
-// instead overwrites the golden fixtures in gf.Dir with those in gf.Fixtures
-// and only returns an error if the update fails.
-func (gf *GoldenFixtures) Test() error {
-	flags, err := parseFlags(gf.Flags)
+// Orphans returns the sorted paths of the golden fixtures in gf.Dir that are
+// not in gf.Fixtures, regardless of IgnoreUnexpected. Files excluded by
+// Exclude are never returned. Unlike Test, it never modifies the golden
+// fixtures, so it's useful for finding stale files, e.g. in a linter.
+func (gf *GoldenFixtures) Orphans() ([]string, error) {
+	diff, err := gf.diff()
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	diff, err := gf.Diff()
-	if err != nil {
-		return err
+	var orphans []string
+	for _, d := range diff.ByKind(DiffUnexpected) {
+		orphans = append(orphans, d.Path)
 	}
+	return orphans, nil
+}
 
-	if flags[FlagUpdate] {
-		return gf.update(diff)
-	} else {
-		return gf.compare(diff, flags[FlagDiff])
-	}
+// diff implements Diff, but also returns DiffUnexpected entries if
+// gf.IgnoreUnexpected is set.
+func (gf *GoldenFixtures) diff() (Diff, error) {
+	flags, _ := parseFlags(gf.Flags)
+	return gf.diffFor(flags[FlagUpdate])
 }
 
-func (gf *GoldenFixtures) update(diff Diff) error {
-	msg := make([]string, 0, len(diff))
+// diffFor implements diff for an update if update is true, which skips
+// VerifyChecksums and Reference.
+func (gf *GoldenFixtures) diffFor(update bool) (Diff, error) {
+	got := gf.Fixtures
+	if gf.Transform != nil {
+		got = Fixtures{}
+		for path, data := range gf.Fixtures {
+			got[path] = gf.Transform(path, data)
+		}
+	}
+	if gf.Session != nil {
+		gf.Session.register(gf.Dir, got.Paths())
+	}
+	if err := gf.checkSize(got); err != nil {
+		return nil, err
+	} else if err := gf.checkStore(); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	want, modes, err := gf.load(got)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to load golden fixtures: %s", err)
+	} else if err := gf.checkSize(want); err != nil {
+		return nil, fmt.Errorf("failed to load golden fixtures: %s", err)
+	}
+	gf.stats.load = time.Since(start)
+	if gf.VerifyChecksums && !update {
+		if err := gf.verifyChecksums(want); err != nil {
+			return nil, err
+		}
+	}
+	if !update {
+		if err := gf.addReferences(got, want); err != nil {
+			return nil, err
+		}
+	}
+	for path, normalize := range gf.normalize {
+		if data, ok := want[path]; ok {
+			want[path] = normalize(data)
+		}
+	}
+	if gf.Only != "" {
+		if _, err := path.Match(gf.Only, ""); err != nil {
+			return nil, fmt.Errorf("bad only pattern: %q: %s", gf.Only, err)
+		}
+		got, want = got.Filter(gf.only), want.Filter(gf.only)
+	}
+	start = time.Now()
+	diff := gf.compareWith(gf.patternDiff(gf.whitespaceDiff(got.Diff(want))))
+	if len(gf.Modes) > 0 && !gf.Archive && gf.Store == nil {
+		diff = append(diff, gf.modeDiff(got, want, modes)...)
+		diff.sort()
+	}
+	gf.stats.compare = time.Since(start)
 	for _, d := range diff {
-		switch d.Kind {
-		case DiffUnexpected:
-			if err := os.Remove(d.Path); err != nil {
-				msg = append(msg, fmt.Sprintf("could not remove: %s: %s", d.Path, err))
+		gf.logf("goldy: diff: %s: %s", d.Kind, d.Path)
+	}
+	gf.stats.fixtures = len(got)
+	gf.stats.bytes = got.TotalSize() + want.TotalSize()
+	return diff, nil
+}
+
+// addReferences adds the data returned by gf.Reference to want for every
+// path in got that is not in want.
+func (gf *GoldenFixtures) addReferences(got, want Fixtures) error {
+	if gf.Reference == nil {
+		return nil
+	}
+	for _, path := range got.Paths() {
+		if _, ok := want[path]; ok {
+			continue
+		}
+		data, ok := gf.references[path]
+		if !ok {
+			var err error
+			if data, err = gf.Reference(path); err != nil {
+				return fmt.Errorf("failed to get reference: %s: %w", path, err)
 			}
-		case DiffMissing, DiffChanged:
-			dir := filepath.Dir(d.Path)
-			if err := os.MkdirAll(dir, 0700); err != nil {
-				msg = append(msg, fmt.Sprintf("could not mkdir: %s: %s", dir, err))
-			} else if err := ioutil.WriteFile(d.Path, gf.Fixtures[d.Path], 0600); err != nil {
-				msg = append(msg, fmt.Sprintf("could not write: %s: %s", d.Path, err))
+			if gf.references == nil {
+				gf.references = map[string][]byte{}
 			}
+			gf.references[path] = data
 		}
-	}
-	if len(msg) > 0 {
-		return fmt.Errorf(
-			"%d errors:\n%s",
-			len(msg),
-			strings.Join(msg, "\n"),
-		)
+		want[path] = data
 	}
 	return nil
 }
 
-func (gf *GoldenFixtures) compare(diff Diff, diffFlag bool) error {
-	if len(diff) == 0 {
+// checkSize returns an error if any fixture in f is larger than
+// gf.MaxFixtureSize.
+func (gf *GoldenFixtures) checkSize(f Fixtures) error {
+	if gf.MaxFixtureSize <= 0 {
 		return nil
 	}
-	var msg []string
-	for _, d := range diff {
-		switch d.Kind {
-		case DiffUnexpected:
-			msg = append(msg, fmt.Sprintf("unexpected file: %s", d.Path))
-		case DiffMissing:
-			msg = append(msg, fmt.Sprintf("missing file: %s", d.Path))
-		case DiffChanged:
-			msg = append(msg, fmt.Sprintf("changed file: %s", d.Path))
-			if diffFlag {
-				msg = append(msg, textDiff(d.A, d.B))
-			}
+	for _, path := range f.Paths() {
+		if size := int64(len(f[path])); size > gf.MaxFixtureSize {
+			return sizeError(path, size, gf.MaxFixtureSize)
 		}
 	}
-	return fmt.Errorf(
-		"%d errors:\n%s\n\nrun `%s` to automatically update all files above",
-		len(diff),
-		strings.Join(msg, "\n"),
-		gf.Hint,
-	)
+	return nil
 }
 
-func textDiff(a, b []byte) string {
-	diff := difflib.UnifiedDiff{
-		A:       difflib.SplitLines(string(a)),
-		B:       difflib.SplitLines(string(b)),
-		Context: 3,
-	}
-	text, _ := difflib.GetUnifiedDiffString(diff)
-	return indent(strings.TrimRight(text, "\n"))
+// sizeError returns the error reported for fixtures larger than
+// MaxFixtureSize.
+func sizeError(path string, size, max int64) error {
+	return fmt.Errorf("fixture too large: %s (%d bytes, limit %d)", path, size, max)
 }
 
-func indent(s string) string {
-	return "  " + strings.Replace(s, "\n", "\n  ", -1)
+// load loads the golden fixtures and their permission bits from gf.Dir,
+// gf.Store or the archive file if gf.Archive is set.
+func (gf *GoldenFixtures) load(got Fixtures) (Fixtures, map[string]os.FileMode, error) {
+	if gf.Store != nil {
+		want, err := gf.loadStore()
+		return want, nil, err
+	} else if gf.Archive {
+		want, err := gf.loadArchive()
+		return want, nil, err
+	}
+	l := &loader{
+		ctx:            context.Background(),
+		exclude:        gf.Exclude,
+		excludeInfo:    gf.ExcludeInfo,
+		excludeContent: gf.ExcludeContent,
+		decompress:     gf.Compress,
+		decodeBase64:   gf.EncodeBinary,
+		followSymlinks: gf.FollowSymlinks,
+		readRetries:    gf.ReadRetries,
+		maxSize:        gf.MaxFixtureSize,
+		logf:           gf.Logf,
+	}
+	if gf.StreamThreshold > 0 {
+		l.streamThreshold, l.got = gf.StreamThreshold, got
+	}
+	return l.load(gf.Dir)
 }
 
-// Load loads a Fixtures from the given path. The exclude func is called for every
-// file and allows excluding paths by returning false.
-func Load(path string, exclude func(path string) bool) (Fixtures, error) {
-	s := Fixtures{}
-	return s, filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		} else if info.IsDir() || exclude(path) {
-			return nil
-		} else if data, err := ioutil.ReadFile(path); err != nil {
-			return err
-		} else {
-			s[path] = data
-			return nil
+// whitespaceDiff returns diff without the DiffChanged entries for text files
+// that only differ in trailing whitespace if gf.IgnoreTrailingWhitespace is
+// set.
+func (gf *GoldenFixtures) whitespaceDiff(diff Diff) Diff {
+	if !gf.IgnoreTrailingWhitespace {
+		return diff
+	}
+	var newDiff Diff
+	for _, d := range diff {
+		if d.Kind == DiffChanged && !isBinary(d.A) && !isBinary(d.B) &&
+			bytes.Equal(trimTrailingWhitespace(d.A), trimTrailingWhitespace(d.B)) {
+			continue
 		}
-	})
+		newDiff = append(newDiff, d)
+	}
+	return newDiff
 }
 
-// IsDotfile returns true if path starts with a ".". This is useful for
-// excluding hidden files on Unix / Linux, e.g. vim undo files.
-func IsDotfile(path string) bool {
-	return strings.HasPrefix(filepath.Base(path), ".")
+// patternDiff returns diff without the DiffChanged entries for text files
+// that are equal after applying gf.IgnorePatterns.
+func (gf *GoldenFixtures) patternDiff(diff Diff) Diff {
+	if len(gf.IgnorePatterns) == 0 {
+		return diff
+	}
+	var newDiff Diff
+	for _, d := range diff {
+		if d.Kind == DiffChanged && !isBinary(d.A) && !isBinary(d.B) {
+			a, b := ReplacePatterns(d.A, gf.IgnorePatterns...), ReplacePatterns(d.B, gf.IgnorePatterns...)
+			if gf.IgnoreTrailingWhitespace {
+				a, b = trimTrailingWhitespace(a), trimTrailingWhitespace(b)
+			}
+			if bytes.Equal(a, b) {
+				continue
+			}
+		}
+		newDiff = append(newDiff, d)
+	}
+	return newDiff
 }
 
-// Fixtures maps file paths to their file contents.
-type Fixtures map[string][]byte
+// ReplacePatterns returns data with every match of the given patterns
+// replaced by the placeholder "<ignored>", see IgnorePatterns.
+func ReplacePatterns(data []byte, patterns ...*regexp.Regexp) []byte {
+	for _, re := range patterns {
+		data = re.ReplaceAllLiteral(data, []byte("<ignored>"))
+	}
+	return data
+}
 
-// Add adds the given path and file contents or panics if the path already
-// exists.
-func (f Fixtures) Add(data []byte, path ...string) {
-	key := filepath.Join(path...)
-	if _, ok := f[key]; ok {
-		panic("set already has path: " + key)
+// trimTrailingWhitespace returns data with the trailing spaces, tabs and
+// carriage returns removed from every line.
+func trimTrailingWhitespace(data []byte) []byte {
+	lines := bytes.Split(data, []byte("\n"))
+	for i, line := range lines {
+		lines[i] = bytes.TrimRight(line, " \t\r")
 	}
-	f[key] = data
+	return bytes.Join(lines, []byte("\n"))
 }
 
-// Diff compares set a with set b and returns the diff. If a and b are equal,
-// the returned len(diff) is 0. See Fixtures.Diff for for more details. The
-// main caller of this func is GoldenFixtures.Diff, in that context b is the
-// existing fixture on disk, and a is the results from the test and we want
-// to show the change from b to a.
-func (a Fixtures) Diff(b Fixtures) Diff {
+// modeDiff returns a DiffModeChanged entry for every path in gf.Modes whose
+// content in got matches the golden fixture in want, but whose mode does not
+// match the golden mode in modes.
+func (gf *GoldenFixtures) modeDiff(got, want Fixtures, modes map[string]os.FileMode) Diff {
 	var diff Diff
-	// First pass through a finds all paths that exist in a but not b or that
-	// exist in both but hold different data.
-	for aPath, aData := range a {
-		d := &FileDiff{
-			Path: aPath,
-			B:    aData,
-		}
-		if bData, ok := b[aPath]; !ok {
-			d.Kind = DiffMissing
-			diff = append(diff, d)
-		} else if !bytes.Equal(aData, bData) {
-			d.Kind = DiffChanged
-			d.A = bData
-			diff = append(diff, d)
-		}
-	}
-	// Second pass through b is needed for finding paths that exist in b, but not
-	// in a.
-	for bPath, _ := range b {
-		if bData, ok := a[bPath]; !ok {
+	for path, mode := range gf.Modes {
+		data, ok := got[path]
+		if !ok {
+			continue
+		} else if wantData, ok := want[path]; !ok || !bytes.Equal(data, wantData) {
+			continue
+		} else if modes[path] != mode {
 			diff = append(diff, &FileDiff{
-				Path: bPath,
-				A:    bData,
-				Kind: DiffUnexpected,
+				Path:  path,
+				Kind:  DiffModeChanged,
+				A:     wantData,
+				B:     data,
+				ModeA: modes[path],
+				ModeB: mode,
 			})
 		}
 	}
-
-	sort.Slice(diff, func(i, j int) bool {
-		return diff[i].Path < diff[j].Path
-	})
 	return diff
 }
 
-// Paths returns all path keys from f in ascending byte order.
-func (f Fixtures) Paths() []string {
-	sorted := make([]string, 0, len(f))
-	for p, _ := range f {
-		sorted = append(sorted, p)
+// Test returns an error if the comparison between gf.Fixtures and the golden
+// fixtures in gf.Dir produced a diff. Or if gf.Flags[FlagUpdate] is true, it
+// instead overwrites the golden fixtures in gf.Dir with those in gf.Fixtures
+// and only returns an error if the update fails.
+func (gf *GoldenFixtures) Test() error {
+	_, err := gf.TestResult()
+	return err
+}
+
+// TestResult is like Test, but also returns a Result describing the diff
+// that was found. The Result is nil if the diff could not be computed.
+func (gf *GoldenFixtures) TestResult() (*Result, error) {
+	flags, err := gf.testFlags()
+	if err != nil {
+		return nil, err
+	} else if flags[FlagRewrite] {
+		return gf.rewrite(flags)
 	}
-	sort.Slice(sorted, func(i, j int) bool {
-		return sorted[i] < sorted[j]
-	})
-	return sorted
+	diff, err := gf.testDiff(flags)
+	if err != nil {
+		return nil, err
+	} else if gf.bootstrap(flags) {
+		r := newResult(diff)
+		r.Updated = len(diff) > 0
+		return r, gf.update(diff)
+	}
+	gf.recordPresence(diff, flags)
+	return gf.result(diff, flags)
 }
 
-type Diff []*FileDiff
+// testFlags parses gf.Flags and runs the checks shared by TestResult and
+// RunSubtests that don't need the golden fixtures.
+func (gf *GoldenFixtures) testFlags() (map[Flag]bool, error) {
+	flags, err := parseFlags(gf.Flags)
+	if err != nil {
+		return nil, err
+	} else if gf.DiffContext < 0 {
+		return nil, fmt.Errorf("negative diff context: %d", gf.DiffContext)
+	} else if err := gf.checkEmpty(); err != nil {
+		return nil, err
+	} else if err := gf.checkExpected(); err != nil {
+		return nil, err
+	}
+	return flags, nil
+}
 
-type FileDiff struct {
-	Path string
-	Kind DiffKind
-	A    []byte
-	B    []byte
+// testDiff returns the diff for TestResult and RunSubtests. It implements
+// DoubleCheck, FlagStats and FlagVerbose along the way.
+func (gf *GoldenFixtures) testDiff(flags map[Flag]bool) (Diff, error) {
+	if !flags[FlagUpdate] {
+		if err := gf.doubleCheck(); err != nil {
+			return nil, err
+		}
+	}
+	diff, err := gf.Diff()
+	if err != nil {
+		return nil, err
+	} else if flags[FlagStats] {
+		fmt.Fprintf(
+			gf.output(),
+			"goldy: stats: dir=%s fixtures=%d bytes=%d load=%s compare=%s\n",
+			gf.Dir,
+			gf.stats.fixtures,
+			gf.stats.bytes,
+			gf.stats.load,
+			gf.stats.compare,
+		)
+	}
+	gf.warnEmpty(diff)
+	if flags[FlagVerbose] {
+		gf.logMatches(diff)
+	}
+	return diff, nil
+}
+
+// checkEmpty implements FailOnEmpty.
+func (gf *GoldenFixtures) checkEmpty() error {
+	if !gf.FailOnEmpty || len(gf.Fixtures) > 0 {
+		return nil
+	}
+	orphans, err := gf.Orphans()
+	if err != nil {
+		return err
+	} else if len(orphans) > 0 {
+		return fmt.Errorf("no fixtures added, but %d golden fixtures exist in: %s", len(orphans), gf.Dir)
+	}
+	return nil
+}
+
+// Expect declares that the fixtures with the given paths relative to gf.Dir
+// must be added before calling Test. If any of them is missing from
+// gf.Fixtures, Test returns an error without comparing or updating anything,
+// regardless of the golden fixtures on disk. This catches generators that
+// silently stop producing a file, even with FlagUpdate.
+func (gf *GoldenFixtures) Expect(paths ...string) {
+	for _, path := range paths {
+		gf.expected = append(gf.expected, gf.join(path))
+	}
+}
+
+// checkExpected implements Expect.
+func (gf *GoldenFixtures) checkExpected() error {
+	var missing []string
+	for _, path := range gf.expected {
+		if _, ok := gf.Fixtures[path]; !ok {
+			missing = append(missing, "not added: "+path)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	sort.Strings(missing)
+	return fmt.Errorf(
+		"%d expected fixtures were not added:\n%s\n\nmake sure the test still produces the files above",
+		len(missing),
+		strings.Join(missing, "\n"),
+	)
+}
+
+// warnEmpty prints a warning to stderr if gf.Fixtures and diff are empty,
+// i.e. nothing was compared at all. This usually means that the test didn't
+// add any fixtures by accident.
+func (gf *GoldenFixtures) warnEmpty(diff Diff) {
+	if len(gf.Fixtures) == 0 && len(diff) == 0 {
+		fmt.Fprintf(gf.output(), "goldy: WARNING: no fixtures added for: %s\n", gf.Dir)
+	}
+}
+
+// logMatches implements FlagVerbose for Test by printing every compared path
+// and its DiffKind, or "ok" if it matched, to stderr.
+func (gf *GoldenFixtures) logMatches(diff Diff) {
+	kinds := map[string]DiffKind{}
+	for _, d := range diff {
+		kinds[d.Path] = d.Kind
+	}
+	paths := gf.Fixtures.Paths()
+	for _, d := range diff.ByKind(DiffUnexpected) {
+		paths = append(paths, d.Path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if gf.Only != "" && !gf.only(path) {
+			continue
+		} else if kind, ok := kinds[path]; ok {
+			fmt.Fprintf(gf.output(), "goldy: %s: %s\n", kind, path)
+		} else {
+			fmt.Fprintf(gf.output(), "goldy: ok: %s\n", path)
+		}
+	}
+}
+
+// bootstrap returns true if the golden fixtures should be created because
+// AutoCreate is set and gf.Dir does not exist, and logs that to stderr.
+func (gf *GoldenFixtures) bootstrap(flags map[Flag]bool) bool {
+	if !gf.AutoCreate || flags[FlagUpdate] {
+		return false
+	}
+	path := gf.Dir
+	var err error
+	if gf.Store != nil {
+		_, err = gf.Store.Load(gf.Dir)
+	} else {
+		if gf.Archive {
+			path = gf.archivePath()
+		}
+		_, err = os.Stat(path)
+	}
+	if !os.IsNotExist(err) {
+		return false
+	}
+	fmt.Fprintf(gf.output(), "goldy: creating missing golden fixtures: %s\n", path)
+	return true
+}
+
+// result updates or compares the golden fixtures for diff according to flags
+// and returns the Result.
+func (gf *GoldenFixtures) result(diff Diff, flags map[Flag]bool) (*Result, error) {
+	r, remaining, err := gf.apply(diff, flags)
+	if err != nil {
+		return r, err
+	} else if r.Updated && flags[FlagUpdate] && flags[FlagFailIfUpdated] {
+		return r, updatedError(diff)
+	}
+	return r, gf.compare(remaining, flags)
+}
+
+// apply updates the golden fixtures for diff according to flags. It returns
+// the Result and the remaining diff that needs to be compared, filtered by
+// ContentOnlyFailures and AllowChanged unless FlagInteractive is set.
+func (gf *GoldenFixtures) apply(diff Diff, flags map[Flag]bool) (*Result, Diff, error) {
+	r := newResult(diff)
+	if flags[FlagUpdate] && flags[FlagDryRun] {
+		return r, nil, gf.dryRun(diff)
+	} else if flags[FlagUpdate] {
+		if err := gf.checkThreshold(diff, flags); err != nil {
+			return r, nil, err
+		}
+		r.Updated = len(diff) > 0
+		return r, nil, gf.update(diff)
+	} else if flags[FlagInteractive] {
+		accepted, rejected, err := gf.interactive(diff)
+		if err != nil {
+			return r, nil, err
+		} else if r.Updated = len(accepted) > 0; r.Updated {
+			if err := gf.update(accepted); err != nil {
+				return r, nil, err
+			}
+		}
+		return r, rejected, nil
+	} else if flags[FlagClean] {
+		var remaining Diff
+		for _, d := range diff {
+			if d.Kind != DiffUnexpected {
+				remaining = append(remaining, d)
+			}
+		}
+		unexpected := diff.ByKind(DiffUnexpected)
+		if flags[FlagDryRun] {
+			if err := gf.dryRun(unexpected); err != nil {
+				return r, nil, err
+			}
+		} else if err := gf.checkThreshold(unexpected, flags); err != nil {
+			return r, nil, err
+		} else if r.Updated = len(unexpected) > 0; r.Updated {
+			if err := gf.update(unexpected); err != nil {
+				return r, nil, err
+			}
+		}
+		diff = remaining
+	}
+	if gf.ContentOnlyFailures {
+		diff = gf.presenceDiff(diff)
+	}
+	if len(gf.allowChanged) > 0 {
+		diff = gf.allowedDiff(diff)
+	}
+	return r, diff, nil
+}
+
+// checkThreshold implements ConfirmThreshold for an update applying diff.
+func (gf *GoldenFixtures) checkThreshold(diff Diff, flags map[Flag]bool) error {
+	if gf.ConfirmThreshold <= 0 || len(diff) <= gf.ConfirmThreshold || flags[FlagForce] {
+		return nil
+	}
+	counts := diff.Counts()
+	return fmt.Errorf(
+		"update would modify %d files in %s (%d changed, %d missing, %d unexpected), more than the confirm threshold of %d\n\nadd the %q flag to update them anyway",
+		len(diff),
+		gf.Dir,
+		counts[DiffChanged],
+		counts[DiffMissing],
+		counts[DiffUnexpected],
+		gf.ConfirmThreshold,
+		FlagForce,
+	)
+}
+
+// RunSubtests is like Test, but reports the result for every fixture in
+// gf.Fixtures and every unexpected file on disk in its own subtest named after
+// the path relative to gf.Dir. This allows to target individual fixtures with
+// `go test -run`. When updating, all files are updated at once before the
+// subtests run.
+func (gf *GoldenFixtures) RunSubtests(t *testing.T) {
+	t.Helper()
+	gf.runSubtests(tRunner{t})
+}
+
+// runner is implemented by *testing.T via tRunner and allows RunSubtests to
+// be tested.
+type runner interface {
+	testing.TB
+	Run(name string, fn func(t testing.TB)) bool
+}
+
+type tRunner struct {
+	*testing.T
+}
+
+func (t tRunner) Run(name string, fn func(t testing.TB)) bool {
+	return t.T.Run(name, func(t *testing.T) { fn(t) })
+}
+
+func (gf *GoldenFixtures) runSubtests(t runner) {
+	t.Helper()
+	flags, err := gf.testFlags()
+	if err != nil {
+		t.Fatal(err)
+		return
+	} else if flags[FlagRewrite] {
+		if _, err := gf.rewrite(flags); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	diff, err := gf.testDiff(flags)
+	if err != nil {
+		t.Fatal(err)
+		return
+	} else if gf.bootstrap(flags) {
+		if err := gf.update(diff); err != nil {
+			t.Fatal(err)
+		}
+		diff = nil
+	}
+	// The golden fixtures are updated all at once, so the subtests only
+	// report the results for their paths.
+	gf.recordPresence(diff, flags)
+	r, remaining, err := gf.apply(diff, flags)
+	if err != nil {
+		t.Fatal(err)
+		return
+	} else if len(remaining) > 0 {
+		if err := gf.reportMismatch(remaining, flags); err != nil {
+			t.Fatal(err)
+			return
+		}
+	}
+	failUpdated := r.Updated && flags[FlagUpdate] && flags[FlagFailIfUpdated]
+	byPath, remainingByPath := map[string]Diff{}, map[string]Diff{}
+	for _, d := range diff {
+		byPath[d.Path] = append(byPath[d.Path], d)
+	}
+	for _, d := range remaining {
+		remainingByPath[d.Path] = append(remainingByPath[d.Path], d)
+	}
+	paths := gf.Fixtures.Paths()
+	for _, d := range diff {
+		if d.Kind == DiffUnexpected {
+			paths = append(paths, d.Path)
+		}
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		name, err := filepath.Rel(gf.Dir, path)
+		if err != nil {
+			name = path
+		}
+		t.Run(filepath.ToSlash(name), func(t testing.TB) {
+			t.Helper()
+			if failUpdated && len(byPath[path]) > 0 {
+				t.Fatal(updatedError(byPath[path]))
+			} else if err := gf.mismatchError(remainingByPath[path], flags); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// recordPresence records the missing and unexpected files from the whole
+// diff for MissingFiles and ExtraFiles if gf.ContentOnlyFailures is set and
+// flags cause them to be compared rather than updated.
+func (gf *GoldenFixtures) recordPresence(diff Diff, flags map[Flag]bool) {
+	gf.missing, gf.extra = nil, nil
+	if !gf.ContentOnlyFailures || flags[FlagUpdate] || flags[FlagInteractive] {
+		return
+	}
+	for _, d := range diff {
+		switch d.Kind {
+		case DiffMissing:
+			gf.missing = append(gf.missing, d.Path)
+		case DiffUnexpected:
+			// FlagClean deletes them instead.
+			if !flags[FlagClean] {
+				gf.extra = append(gf.extra, d.Path)
+			}
+		}
+	}
+}
+
+// presenceDiff logs the missing and unexpected files from diff and returns
+// the remaining diff, see recordPresence.
+func (gf *GoldenFixtures) presenceDiff(diff Diff) Diff {
+	var newDiff Diff
+	for _, d := range diff {
+		switch d.Kind {
+		case DiffMissing:
+			fmt.Fprintf(gf.output(), "goldy: ignoring missing file: %s\n", d.Path)
+		case DiffUnexpected:
+			fmt.Fprintf(gf.output(), "goldy: ignoring unexpected file: %s\n", d.Path)
+		default:
+			newDiff = append(newDiff, d)
+		}
+	}
+	return newDiff
+}
+
+// AllowChanged marks the fixture with the given path relative to gf.Dir as
+// quarantined. If its content changes, Test logs a warning to stderr instead
+// of returning an error. Missing or unexpected files are not affected.
+func (gf *GoldenFixtures) AllowChanged(path ...string) {
+	if gf.allowChanged == nil {
+		gf.allowChanged = map[string]bool{}
+	}
+	gf.allowChanged[gf.join(path...)] = true
+}
+
+// allowedDiff logs the changed files from diff that are quarantined via
+// AllowChanged and returns the remaining diff.
+func (gf *GoldenFixtures) allowedDiff(diff Diff) Diff {
+	var newDiff Diff
+	for _, d := range diff {
+		if d.Kind == DiffChanged && gf.allowChanged[d.Path] {
+			fmt.Fprintf(gf.output(), "goldy: warning: ignoring allowed change: %s\n", d.Path)
+		} else {
+			newDiff = append(newDiff, d)
+		}
+	}
+	return newDiff
+}
+
+// MissingFiles returns the paths of the files that were missing on disk
+// during the last call to Test or RunSubtests with ContentOnlyFailures.
+func (gf *GoldenFixtures) MissingFiles() []string {
+	return gf.missing
+}
+
+// ExtraFiles returns the paths of the unexpected files found on disk during
+// the last call to Test or RunSubtests with ContentOnlyFailures.
+func (gf *GoldenFixtures) ExtraFiles() []string {
+	return gf.extra
+}
+
+// Result describes the outcome of GoldenFixtures.TestResult. It can be
+// serialized as JSON for consumption by other tools.
+type Result struct {
+	// Counts holds the number of entries in Diff for every DiffKind.
+	Counts map[DiffKind]int `json:"counts"`
+	// Diff is the diff between the in-memory and the golden fixtures.
+	Diff Diff `json:"diff"`
+	// Updated is true if the golden fixtures were updated to resolve Diff.
+	Updated bool `json:"updated"`
+}
+
+// newResult returns a Result for diff.
+func newResult(diff Diff) *Result {
+	r := &Result{Counts: map[DiffKind]int{}, Diff: diff}
+	for _, d := range diff {
+		r.Counts[d.Kind]++
+	}
+	return r
+}
+
+// updatedError returns the error reported for FlagFailIfUpdated.
+func updatedError(diff Diff) error {
+	msg := make([]string, 0, len(diff))
+	for _, d := range diff {
+		msg = append(msg, fmt.Sprintf("updated file: %s", d.Path))
+	}
+	return fmt.Errorf(
+		"%d files were updated:\n%s\n\ncommit the updated files above",
+		len(diff),
+		strings.Join(msg, "\n"),
+	)
+}
+
+// dryRun returns an error describing the operations update would perform to
+// resolve diff, grouped by operation.
+func (gf *GoldenFixtures) dryRun(diff Diff) error {
+	if len(diff) == 0 {
+		return nil
+	}
+	ops := []struct {
+		Kind DiffKind
+		Name string
+	}{
+		{DiffMissing, "create"},
+		{DiffChanged, "overwrite"},
+		{DiffModeChanged, "chmod"},
+		{DiffUnexpected, "delete"},
+	}
+	var msg []string
+	for _, op := range ops {
+		for _, d := range diff {
+			if d.Kind == op.Kind {
+				msg = append(msg, fmt.Sprintf("%s: %s", op.Name, d.Path))
+			}
+		}
+	}
+	return fmt.Errorf(
+		"dry-run: %d planned operations:\n%s",
+		len(diff),
+		strings.Join(msg, "\n"),
+	)
+}
+
+// update applies diff to the golden fixtures on disk, calls gf.OnUpdate and
+// refreshes the checksum manifest if gf.VerifyChecksums is set.
+func (gf *GoldenFixtures) update(diff Diff) error {
+	written, err := gf.updateFixtures(diff)
+	if err != nil {
+		return err
+	} else if gf.OnUpdate != nil && len(written) > 0 {
+		sort.Strings(written)
+		if err := gf.OnUpdate(written); err != nil {
+			return fmt.Errorf("on update: %w", err)
+		}
+	}
+	if !gf.VerifyChecksums {
+		return nil
+	}
+	return gf.writeChecksums()
+}
+
+// updateFixtures implements update for the golden fixtures themselves. It
+// returns the paths of the files that were written.
+func (gf *GoldenFixtures) updateFixtures(diff Diff) ([]string, error) {
+	if gf.Store != nil {
+		return nil, gf.updateStore(diff)
+	} else if gf.Archive {
+		return nil, gf.updateArchive(diff)
+	}
+	var (
+		errs    []error
+		written []string
+	)
+	for _, d := range diff {
+		switch d.Kind {
+		case DiffUnexpected:
+			path := gf.diskPath(d.Path)
+			if err := os.Remove(path); err != nil {
+				errs = append(errs, fmt.Errorf("could not remove: %s: %w", path, err))
+				continue
+			}
+			gf.logf("goldy: removed: %s", path)
+			if !gf.KeepEmptyDirs {
+				gf.pruneDirs(filepath.Dir(path))
+			}
+		case DiffMissing, DiffChanged:
+			if ok, err := gf.write(d.Path, d.B); err != nil {
+				errs = append(errs, err)
+			} else if ok {
+				gf.logf("goldy: wrote: %s", d.Path)
+				written = append(written, gf.diskPath(d.Path))
+			} else {
+				gf.logf("goldy: unchanged: %s", d.Path)
+			}
+		case DiffModeChanged:
+			path := gf.diskPath(d.Path)
+			if err := os.Chmod(path, d.ModeB); err != nil {
+				errs = append(errs, fmt.Errorf("could not chmod: %s: %w", path, err))
+			} else {
+				gf.logf("goldy: chmod: %s (%04o)", path, uint32(d.ModeB))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		sort.Slice(errs, func(i, j int) bool {
+			return errs[i].Error() < errs[j].Error()
+		})
+		return written, fmt.Errorf("%d errors:\n%w", len(errs), errors.Join(errs...))
+	}
+	return written, nil
+}
+
+// rewrite implements FlagRewrite.
+func (gf *GoldenFixtures) rewrite(flags map[Flag]bool) (*Result, error) {
+	if dir := filepath.Clean(gf.Dir); gf.Dir == "" || dir == "." || dir == filepath.VolumeName(dir)+string(filepath.Separator) {
+		return nil, fmt.Errorf("refusing to rewrite dir: %q", gf.Dir)
+	}
+	// The net changes of the rewrite, i.e. like an update that also removes
+	// unexpected files regardless of IgnoreUnexpected.
+	plan, err := gf.diffFor(true)
+	if err != nil {
+		return nil, err
+	} else if flags[FlagDryRun] {
+		return newResult(plan), gf.dryRun(plan)
+	} else if err := gf.checkThreshold(plan, flags); err != nil {
+		return newResult(plan), err
+	}
+	if gf.Store != nil {
+		// Like for dirs, excluded golden fixtures are kept.
+		if err := gf.updateStore(plan.ByKind(DiffUnexpected)); err != nil {
+			return nil, err
+		}
+	} else if gf.Archive {
+		// Like for dirs, excluded entries are kept.
+		if err := gf.updateArchive(plan.ByKind(DiffUnexpected)); err != nil {
+			return nil, err
+		}
+	} else {
+		var remove []string
+		err := filepath.Walk(gf.Dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			} else if info.IsDir() || gf.Exclude(path) ||
+				(gf.ExcludeInfo != nil && gf.ExcludeInfo(path, info)) {
+				return nil
+			} else if gf.Only != "" && !gf.only(trimEncodingSuffix(path)) {
+				return nil
+			} else if excluded, err := gf.excludeContent(path); err != nil || excluded {
+				return err
+			}
+			remove = append(remove, path)
+			return nil
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		for _, path := range remove {
+			if err := os.Remove(path); err != nil {
+				return nil, fmt.Errorf("could not remove: %s: %w", path, err)
+			}
+			gf.logf("goldy: removed: %s", path)
+			gf.pruneDirs(filepath.Dir(path))
+		}
+	}
+
+	// The golden fixtures are gone now, so neither Reference nor
+	// VerifyChecksums must be applied.
+	diff, err := gf.filterUnexpected(gf.diffFor(true))
+	if err != nil {
+		return nil, err
+	}
+	r := newResult(plan)
+	r.Updated = len(plan) > 0
+	if err := gf.update(diff); err != nil {
+		return r, err
+	} else if r.Updated && flags[FlagFailIfUpdated] {
+		return r, updatedError(plan)
+	}
+	return r, nil
+}
+
+// excludeContent returns true if gf.ExcludeContent excludes the golden
+// fixture at the given path.
+func (gf *GoldenFixtures) excludeContent(path string) (bool, error) {
+	if gf.ExcludeContent == nil {
+		return false, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	file := path
+	if gf.EncodeBinary && strings.HasSuffix(file, ".b64") {
+		file = strings.TrimSuffix(file, ".b64")
+		if data, err = unbase64Data(data); err != nil {
+			return false, fmt.Errorf("could not decode: %s: %s", path, err)
+		}
+	}
+	if gf.Compress && strings.HasSuffix(file, ".gz") {
+		if data, err = gunzipData(data); err != nil {
+			return false, fmt.Errorf("could not decompress: %s: %s", path, err)
+		}
+	}
+	return gf.ExcludeContent(path, data), nil
+}
+
+// trimEncodingSuffix returns path without the ".b64" and ".gz" suffixes
+// added by EncodeBinary and Compress, if any.
+func trimEncodingSuffix(path string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(path, ".b64"), ".gz")
+}
+
+// write writes the golden fixture with the given path and data to disk. If
+// the file on disk already holds data, e.g. because it only differed from
+// the fixture after normalization, it's not rewritten to preserve its
+// modification time, and false is returned.
+func (gf *GoldenFixtures) write(path string, data []byte) (bool, error) {
+	mode, hasMode := gf.Modes[fixtureKey(path)]
+	if !hasMode {
+		mode = gf.fileMode()
+	}
+	path = filepath.FromSlash(path)
+	file := path
+	if gf.Compress {
+		file = path + ".gz"
+		var err error
+		if data, err = gzipData(data); err != nil {
+			return false, fmt.Errorf("could not compress: %s: %w", path, err)
+		}
+	}
+	if gf.EncodeBinary && isBinary(data) {
+		file += ".b64"
+		data = base64Data(data)
+	}
+	written := true
+	if existing, err := ioutil.ReadFile(file); err == nil && bytes.Equal(existing, data) {
+		written = false
+		if info, err := os.Stat(file); err != nil {
+			return false, err
+		} else if hasMode && info.Mode().Perm() != mode {
+			if err := os.Chmod(file, mode); err != nil {
+				return false, fmt.Errorf("could not chmod: %s: %w", file, err)
+			}
+		}
+	} else {
+		dir := filepath.Dir(file)
+		if err := os.MkdirAll(dir, gf.dirMode()); err != nil {
+			return false, fmt.Errorf("could not mkdir: %s: %w", dir, err)
+		} else if err := writeFile(file, data, mode); err != nil {
+			return false, fmt.Errorf("could not write: %s: %w", file, err)
+		}
+	}
+	// Remove any other version of the file, e.g. an uncompressed one.
+	for _, other := range gf.diskPaths(path) {
+		if other == file {
+			continue
+		} else if err := os.Remove(other); err != nil && !os.IsNotExist(err) {
+			return written, fmt.Errorf("could not remove: %s: %w", other, err)
+		}
+	}
+	return written, nil
+}
+
+// writeFile atomically writes data to the file at the given path with the
+// given mode. The data is written to a temporary file in the same dir first,
+// which then replaces the file.
+func writeFile(path string, data []byte, mode os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	} else if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	} else if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// output returns gf.Output or stderr if it's not set.
+func (gf *GoldenFixtures) output() io.Writer {
+	if gf.Output == nil {
+		return stderr
+	}
+	return gf.Output
+}
+
+// logf calls gf.Logf if it is set.
+func (gf *GoldenFixtures) logf(format string, args ...interface{}) {
+	if gf.Logf != nil {
+		gf.Logf(format, args...)
+	}
+}
+
+// fileMode returns gf.FileMode or the default file mode if it's not set.
+func (gf *GoldenFixtures) fileMode() os.FileMode {
+	if gf.FileMode == 0 {
+		return defaultFileMode
+	}
+	return gf.FileMode
+}
+
+// dirMode returns gf.DirMode or the default dir mode if it's not set.
+func (gf *GoldenFixtures) dirMode() os.FileMode {
+	if gf.DirMode == 0 {
+		return defaultDirMode
+	}
+	return gf.DirMode
+}
+
+// diskPath returns the path of the file on disk that holds the golden fixture
+// with the given path.
+func (gf *GoldenFixtures) diskPath(path string) string {
+	path = filepath.FromSlash(path)
+	for _, file := range gf.diskPaths(path) {
+		if _, err := os.Lstat(file); err == nil {
+			return file
+		}
+	}
+	return path
+}
+
+// diskPaths returns the paths of the files on disk that may hold the golden
+// fixture with the given path depending on gf.Compress and gf.EncodeBinary,
+// in the order they are preferred.
+func (gf *GoldenFixtures) diskPaths(path string) []string {
+	paths := []string{path}
+	if gf.Compress {
+		paths = []string{path + ".gz", path}
+	}
+	if gf.EncodeBinary {
+		var encoded []string
+		for _, p := range paths {
+			encoded = append(encoded, p+".b64")
+		}
+		paths = append(encoded, paths...)
+	}
+	return paths
+}
+
+// pruneDirs removes dir and its parents up to, but not including, gf.Dir as
+// long as they are empty.
+func (gf *GoldenFixtures) pruneDirs(dir string) {
+	for {
+		rel, err := filepath.Rel(gf.Dir, dir)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			return
+		} else if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// compare returns an error describing diff, if it's not empty, after
+// reporting it via FlagJSON and OnMismatch.
+func (gf *GoldenFixtures) compare(diff Diff, flags map[Flag]bool) error {
+	if len(diff) == 0 {
+		return nil
+	} else if err := gf.reportMismatch(diff, flags); err != nil {
+		return err
+	}
+	return gf.mismatchError(diff, flags)
+}
+
+// reportMismatch implements FlagJSON and OnMismatch for diff.
+func (gf *GoldenFixtures) reportMismatch(diff Diff, flags map[Flag]bool) error {
+	if flags[FlagJSON] {
+		data, err := diff.marshalJSON(flags[FlagVerbose])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "%s\n", data)
+	}
+	if gf.OnMismatch != nil {
+		gf.OnMismatch(diff)
+	}
+	return nil
+}
+
+// mismatchError returns the error describing diff for compare, or nil if
+// diff is empty.
+func (gf *GoldenFixtures) mismatchError(diff Diff, flags map[Flag]bool) error {
+	if len(diff) == 0 {
+		return nil
+	}
+	artifacts := gf.writeArtifacts(diff)
+	if flags[FlagQuiet] && artifacts != "" {
+		return fmt.Errorf("%s; %s", quietError(diff), artifacts)
+	} else if flags[FlagQuiet] {
+		return quietError(diff)
+	}
+	color := flags[FlagColor] && os.Getenv("NO_COLOR") == "" && isTerminal(os.Stdout)
+	var (
+		msg     []string
+		spent   time.Duration
+		omitted int
+		hidden  int
+	)
+	for _, d := range diff {
+		msg = append(msg, d.summary(gf.displayPath(d.Path)))
+		if d.Kind != DiffChanged {
+			continue
+		} else if strings.Contains(d.Detail, "\n") {
+			msg = append(msg, truncateLines(indent(d.Detail), gf.MaxDiffLines))
+			continue
+		} else if d.Detail != "" || isBinary(d.A) || isBinary(d.B) {
+			continue
+		} else if !flags[FlagDiff] && !gf.autoDiff(d) {
+			hidden++
+			continue
+		} else if gf.DiffBudget > 0 && spent >= gf.DiffBudget {
+			omitted++
+			msg = append(msg, indent("(diff omitted)"))
+			continue
+		}
+		start := time.Now()
+		msg = append(msg, truncateLines(renderDiff(d.A, d.B, gf.diffContext(), color), gf.MaxDiffLines))
+		spent += time.Since(start)
+	}
+	if omitted > 0 {
+		msg = append(msg, fmt.Sprintf("\ndiff budget of %s exceeded, omitted %d diffs", gf.DiffBudget, omitted))
+	}
+	var hints []string
+	if gf.Hint != "" {
+		hints = append(hints, gf.updateHint())
+	}
+	if hidden > 0 && gf.DiffHint != "" {
+		hints = append(hints, fmt.Sprintf("run `%s` to show the diffs of the changed files above", gf.DiffHint))
+	}
+	if artifacts != "" {
+		hints = append(hints, artifacts)
+	}
+	if len(hints) == 0 {
+		return fmt.Errorf("%d errors:\n%s", len(diff), strings.Join(msg, "\n"))
+	}
+	return fmt.Errorf("%d errors:\n%s\n\n%s", len(diff), strings.Join(msg, "\n"), strings.Join(hints, "\n"))
+}
+
+// updateHint returns the line telling the user how to update the golden
+// fixtures via gf.Hint.
+func (gf *GoldenFixtures) updateHint() string {
+	return fmt.Sprintf("run `%s` to automatically update all files above", gf.Hint)
+}
+
+// writeArtifacts implements ArtifactsDir by writing the data of all changed
+// and missing fixtures in diff. It returns a message describing the result,
+// or "" if gf.ArtifactsDir is empty or there was nothing to write.
+func (gf *GoldenFixtures) writeArtifacts(diff Diff) string {
+	if gf.ArtifactsDir == "" {
+		return ""
+	}
+	artifacts := Fixtures{}
+	for _, d := range diff {
+		if d.Kind == DiffChanged || d.Kind == DiffMissing {
+			artifacts[artifactPath(d.Path)] = d.B
+		}
+	}
+	if len(artifacts) == 0 {
+		return ""
+	} else if err := artifacts.WriteDir(gf.ArtifactsDir, gf.fileMode()); err != nil {
+		return fmt.Sprintf("could not write artifacts: %s", err)
+	}
+	return fmt.Sprintf("the actual data of the files above was written to: %s", gf.ArtifactsDir)
+}
+
+// artifactPath returns the fixture path relative to ArtifactsDir that
+// mirrors path. The volume name, leading separators and ".." elements are
+// dropped, so the result is always inside of ArtifactsDir.
+func artifactPath(path string) string {
+	path = filepath.FromSlash(path)
+	path = strings.TrimPrefix(path, filepath.VolumeName(path))
+	var elems []string
+	for _, elem := range strings.Split(filepath.ToSlash(path), "/") {
+		if elem != "" && elem != "." && elem != ".." {
+			elems = append(elems, elem)
+		}
+	}
+	return strings.Join(elems, "/")
+}
+
+// displayPath returns path relative to gf.DisplayDir for error messages. It
+// returns path unmodified if gf.DisplayDir is empty or path is not inside of
+// it.
+func (gf *GoldenFixtures) displayPath(path string) string {
+	if gf.DisplayDir == "" {
+		return path
+	}
+	rel, err := filepath.Rel(gf.DisplayDir, filepath.FromSlash(path))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
+
+// diffContext returns gf.DiffContext or DefaultDiffContext if it's 0.
+func (gf *GoldenFixtures) diffContext() int {
+	if gf.DiffContext == 0 {
+		return DefaultDiffContext
+	}
+	return gf.DiffContext
+}
+
+// quietError returns the single line error reported by compare for
+// FlagQuiet.
+func quietError(diff Diff) error {
+	counts := diff.Counts()
+	summary := fmt.Sprintf(
+		"%d changed, %d missing, %d unexpected",
+		counts[DiffChanged],
+		counts[DiffMissing],
+		counts[DiffUnexpected],
+	)
+	if n := counts[DiffModeChanged]; n > 0 {
+		summary += fmt.Sprintf(", %d mode changed", n)
+	}
+	return fmt.Errorf("%d fixtures differ (%s)", len(diff), summary)
+}
+
+// autoDiff returns true if d is small enough to be shown with a diff without
+// FlagDiff, see AutoDiffLimit.
+func (gf *GoldenFixtures) autoDiff(d *FileDiff) bool {
+	return gf.AutoDiffLimit > 0 && len(d.A) <= gf.AutoDiffLimit && len(d.B) <= gf.AutoDiffLimit
+}
+
+// renderDiff is used by compare to render diffs. It's a variable so tests can
+// replace it.
+var renderDiff = textDiff
+
+// maxDiffLineLength is the length in bytes of the longest line textDiff
+// renders as a unified diff.
+const maxDiffLineLength = 1024
+
+// textDiff returns a unified diff of a and b, or a hexDiff if either of them
+// is not valid UTF-8 or has a line longer than maxDiffLineLength, e.g.
+// because it has no newlines at all, which line based diffs can't show in a
+// readable way.
+func textDiff(a, b []byte, context int, color bool) string {
+	var text string
+	if !utf8.Valid(a) || !utf8.Valid(b) || hasLongLine(a) || hasLongLine(b) {
+		text = hexDiff(a, b)
+	} else {
+		diff := difflib.UnifiedDiff{
+			A:       difflib.SplitLines(string(a)),
+			B:       difflib.SplitLines(string(b)),
+			Context: context,
+		}
+		text, _ = difflib.GetUnifiedDiffString(diff)
+	}
+	text = strings.TrimRight(text, "\n")
+	if color {
+		text = colorize(text)
+	}
+	return indent(text)
+}
+
+// hasLongLine returns true if data has a line longer than
+// maxDiffLineLength.
+func hasLongLine(data []byte) bool {
+	for len(data) > maxDiffLineLength {
+		i := bytes.IndexByte(data, '\n')
+		if i == -1 || i > maxDiffLineLength {
+			return true
+		}
+		data = data[i+1:]
+	}
+	return false
+}
+
+// hexDiff returns a hex dump style diff of a and b with 16 bytes per row.
+// Only the rows that differ are included, the ones from a prefixed with "-"
+// and the ones from b with "+", e.g.
+//
+//	-00000010  68 65 6c 6c 6f                                    |hello|
+//	+00000010  68 61 6c 6c 6f                                    |hallo|
+func hexDiff(a, b []byte) string {
+	const width = 16
+	row := func(data []byte, offset int) []byte {
+		if offset >= len(data) {
+			return nil
+		} else if end := offset + width; end < len(data) {
+			return data[offset:end]
+		}
+		return data[offset:]
+	}
+	var lines []string
+	for offset := 0; offset < len(a) || offset < len(b); offset += width {
+		rowA, rowB := row(a, offset), row(b, offset)
+		if bytes.Equal(rowA, rowB) {
+			continue
+		}
+		for _, r := range []struct {
+			prefix string
+			data   []byte
+		}{{"-", rowA}, {"+", rowB}} {
+			if r.data == nil {
+				continue
+			}
+			hex := make([]string, len(r.data))
+			printable := make([]byte, len(r.data))
+			for i, c := range r.data {
+				hex[i] = fmt.Sprintf("%02x", c)
+				if printable[i] = c; c < 0x20 || c > 0x7e {
+					printable[i] = '.'
+				}
+			}
+			lines = append(lines, fmt.Sprintf("%s%08x  %-*s  |%s|", r.prefix, offset, width*3-1, strings.Join(hex, " "), printable))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+const (
+	ansiRed   = "\x1b[31m"
+	ansiGreen = "\x1b[32m"
+	ansiReset = "\x1b[0m"
+)
+
+// colorize wraps the added lines of the unified diff text in green and the
+// removed lines in red.
+func colorize(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, "+") {
+			lines[i] = ansiGreen + line + ansiReset
+		} else if strings.HasPrefix(line, "-") {
+			lines[i] = ansiRed + line + ansiReset
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// isTerminal returns true if f is a terminal. It's a variable so tests can
+// replace it.
+var isTerminal = func(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// isBinary returns true if data contains a NUL byte.
+func isBinary(data []byte) bool {
+	return bytes.IndexByte(data, 0) != -1
+}
+
+// binarySummary describes the difference between a and b in bytes.
+func binarySummary(a, b []byte) string {
+	differ := len(a) - len(b)
+	if differ < 0 {
+		differ = -differ
+	}
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			differ++
+		}
+	}
+	return fmt.Sprintf("(%d -> %d bytes, %d bytes differ)", len(a), len(b), differ)
+}
+
+// truncateLines returns the first max lines of the indented text s followed by
+// a marker line for the omitted lines. It returns s if max is 0 or s has no
+// more than max lines.
+func truncateLines(s string, max int) string {
+	lines := strings.Split(s, "\n")
+	if max <= 0 || len(lines) <= max {
+		return s
+	}
+	marker := indent(fmt.Sprintf("... (%d more lines)", len(lines)-max))
+	return strings.Join(append(lines[:max:max], marker), "\n")
+}
+
+func indent(s string) string {
+	return "  " + strings.Replace(s, "\n", "\n  ", -1)
+}
+
+// Fixtures maps file paths to their file contents. The paths are cleaned and
+// use forward slashes as separators on all platforms, so fixtures are
+// portable between operating systems. They are converted to OS specific
+// paths when reading or writing files. Like any map, Fixtures is not safe for
+// concurrent use, see SafeFixtures and GoldenFixtures.AddSafe.
+type Fixtures map[string][]byte
+
+// fixtureKey returns the Fixtures key for the given OS specific path.
+func fixtureKey(path string) string {
+	return filepath.ToSlash(filepath.Clean(path))
+}
+
+// checkLocal returns an error if the fixture key is absolute or leaves the
+// dir it's relative to, e.g. "../a.txt", like an entry of a malicious archive.
+func checkLocal(key string) error {
+	if !filepath.IsLocal(filepath.FromSlash(key)) {
+		return fmt.Errorf("path outside of root: %s", key)
+	}
+	return nil
+}
+
+// Add adds the given path and file contents or panics if the path already
+// exists. The path elements are joined and cleaned, so Add(d, "a", "b") and
+// Add(d, "./a/b") refer to the same path. See Fixtures for the key format.
+// Use Set instead if overwriting an existing path is intended.
+func (f Fixtures) Add(data []byte, path ...string) {
+	key := fixtureKey(filepath.Join(path...))
+	if _, ok := f[key]; ok {
+		panic(fmt.Sprintf("set already has path: %s (added as %q)", key, path))
+	}
+	f[key] = data
+}
+
+// Set is like Add, but overwrites the file contents if the path already
+// exists instead of panicking, i.e. the last call for a path wins.
+func (f Fixtures) Set(data []byte, path ...string) {
+	f[fixtureKey(filepath.Join(path...))] = data
+}
+
+// Get returns the contents for the given path, which is joined and cleaned
+// like in Add, and true if it exists in f.
+func (f Fixtures) Get(path ...string) ([]byte, bool) {
+	data, ok := f[fixtureKey(filepath.Join(path...))]
+	return data, ok
+}
+
+// Filter returns a new Fixtures holding the entries of f for which keep
+// returns true.
+func (f Fixtures) Filter(keep func(path string) bool) Fixtures {
+	s := Fixtures{}
+	for path, data := range f {
+		if keep(path) {
+			s[path] = data
+		}
+	}
+	return s
+}
+
+// WriteDir writes every entry of f to its path inside of dir using the given
+// file mode. Missing dirs are created with mode 0700. Every file is written
+// atomically, see Fixtures.Diff for comparing f against dir instead. Nothing
+// is written if any path is absolute or outside of dir.
+func (f Fixtures) WriteDir(dir string, mode os.FileMode) error {
+	for path := range f {
+		if err := checkLocal(path); err != nil {
+			return err
+		}
+	}
+	return f.Walk(func(path string, data []byte) error {
+		file := filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(file), defaultDirMode); err != nil {
+			return fmt.Errorf("could not mkdir: %s: %w", filepath.Dir(file), err)
+		} else if err := writeFile(file, data, mode); err != nil {
+			return fmt.Errorf("could not write: %s: %w", file, err)
+		}
+		return nil
+	})
+}
+
+// Sub returns the entries of f whose paths are inside of the dir prefix, with
+// their keys relative to prefix. The prefix is matched by path elements, so
+// "a" matches "a/b.txt", but not "ab/c.txt", regardless of a trailing
+// separator.
+func (f Fixtures) Sub(prefix string) Fixtures {
+	s := Fixtures{}
+	prefix = fixtureKey(prefix)
+	if prefix != "." && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	for path, data := range f {
+		if prefix == "." {
+			s[path] = data
+		} else if strings.HasPrefix(path, prefix) {
+			s[path[len(prefix):]] = data
+		}
+	}
+	return s
+}
+
+// Merge adds all entries from other to f. If a path exists in both, f is not
+// modified and an error is returned.
+func (f Fixtures) Merge(other Fixtures) error {
+	for _, path := range other.Paths() {
+		if _, ok := f[path]; ok {
+			return fmt.Errorf("set already has path: %s", path)
+		}
+	}
+	f.MergeOverwrite(other)
+	return nil
+}
+
+// Rename returns a new Fixtures with the entries of f stored under the paths
+// returned by fn, which are cleaned like in Add. Entries for which fn
+// returns keep=false are dropped. An error is returned if fn maps more than
+// one path to the same new path.
+func (f Fixtures) Rename(fn func(old string) (new string, keep bool)) (Fixtures, error) {
+	s := Fixtures{}
+	from := map[string]string{}
+	for _, path := range f.Paths() {
+		newPath, keep := fn(path)
+		if !keep {
+			continue
+		}
+		newPath = fixtureKey(newPath)
+		if old, ok := from[newPath]; ok {
+			return nil, fmt.Errorf("rename collision: %s and %s both map to %s", old, path, newPath)
+		}
+		from[newPath] = path
+		s[newPath] = f[path]
+	}
+	return s, nil
+}
+
+// MergeOverwrite adds all entries from other to f, replacing existing entries
+// with the same path.
+func (f Fixtures) MergeOverwrite(other Fixtures) {
+	for path, data := range other {
+		f[path] = data
+	}
+}
+
+// Diff compares set a with set b and returns the diff. If a and b are equal,
+// the returned len(diff) is 0. See Fixtures.Diff for for more details. The
+// main caller of this func is GoldenFixtures.Diff, in that context b is the
+// existing fixture on disk, and a is the results from the test and we want
+// to show the change from b to a.
+func (a Fixtures) Diff(b Fixtures) Diff {
+	return a.DiffInto(b, nil)
+}
+
+// DiffInto is like Diff, but appends the diff to dst[:0] and returns it. The
+// FileDiff entries referenced by dst, including those beyond its length up to
+// its capacity, are overwritten and reused. This avoids allocations when
+// diffing repeatedly, e.g.
+//
+//	var diff goldy.Diff
+//	for ... {
+//		diff = a.DiffInto(b, diff)
+//	}
+func (a Fixtures) DiffInto(b Fixtures, dst Diff) Diff {
+	return a.diffInto(b, DiffOptions{}, dst)
+}
+
+// DiffOptions controls the behavior of Fixtures.DiffWith.
+type DiffOptions struct {
+	// SwapSides treats a as the expected fixtures and b as the actual ones,
+	// i.e. a.DiffWith(b, DiffOptions{SwapSides: true}) equals b.Diff(a). Files
+	// only present in b are then reported as DiffMissing and files only
+	// present in a as DiffUnexpected. This is useful if a holds the source of
+	// truth, e.g. data generated by a reference implementation.
+	SwapSides bool
+	// DetectRenames replaces every pair of a DiffMissing and a DiffUnexpected
+	// entry with the same, non-empty content by a single DiffRenamed entry,
+	// similar to the rename detection of git. If several files share the same
+	// content, they are paired in path order.
+	DetectRenames bool
+}
+
+// DiffWith is like Diff, but allows to customize the comparison via opts.
+func (a Fixtures) DiffWith(b Fixtures, opts DiffOptions) Diff {
+	return a.diffInto(b, opts, nil)
+}
+
+// diffInto implements DiffWith and DiffInto.
+func (a Fixtures) diffInto(b Fixtures, opts DiffOptions, dst Diff) Diff {
+	if opts.SwapSides {
+		a, b = b, a
+	}
+	diff := dst[:0]
+	// First pass through a finds all paths that exist in a but not b or that
+	// exist in both but hold different data.
+	for aPath, aData := range a {
+		if bData, ok := b[aPath]; !ok {
+			diff = diff.add(aPath, DiffMissing, nil, aData)
+		} else if !bytes.Equal(aData, bData) {
+			diff = diff.add(aPath, DiffChanged, bData, aData)
+		}
+	}
+	// Second pass through b is needed for finding paths that exist in b, but not
+	// in a.
+	for bPath, bData := range b {
+		if _, ok := a[bPath]; !ok {
+			diff = diff.add(bPath, DiffUnexpected, bData, nil)
+		}
+	}
+
+	diff.sort()
+	if opts.DetectRenames {
+		diff = diff.detectRenames()
+	}
+	return diff
+}
+
+// detectRenames implements DiffOptions.DetectRenames for the sorted diff d.
+func (d Diff) detectRenames() Diff {
+	unexpected := map[string][]*FileDiff{}
+	for _, fd := range d {
+		if fd.Kind == DiffUnexpected && len(fd.A) > 0 {
+			unexpected[string(fd.A)] = append(unexpected[string(fd.A)], fd)
+		}
+	}
+	renamed := map[*FileDiff]bool{}
+	for _, fd := range d {
+		if fd.Kind != DiffMissing || len(unexpected[string(fd.B)]) == 0 {
+			continue
+		}
+		candidates := unexpected[string(fd.B)]
+		old := candidates[0]
+		unexpected[string(fd.B)] = candidates[1:]
+		renamed[old] = true
+		fd.Kind, fd.OldPath, fd.A = DiffRenamed, old.Path, old.A
+	}
+	if len(renamed) == 0 {
+		return d
+	}
+	newDiff := d[:0]
+	for _, fd := range d {
+		if !renamed[fd] {
+			newDiff = append(newDiff, fd)
+		}
+	}
+	return newDiff
+}
+
+// add appends a FileDiff with the given fields to d, reusing the FileDiff
+// beyond the length of d if its capacity allows.
+func (d Diff) add(path string, kind DiffKind, a, b []byte) Diff {
+	if len(d) < cap(d) && d[:len(d)+1][len(d)] != nil {
+		d = d[:len(d)+1]
+		*d[len(d)-1] = FileDiff{Path: path, Kind: kind, A: a, B: b}
+		return d
+	}
+	return append(d, &FileDiff{Path: path, Kind: kind, A: a, B: b})
+}
+
+// TotalSize returns the total number of bytes of all entries in f.
+func (f Fixtures) TotalSize() int64 {
+	var size int64
+	for _, data := range f {
+		size += int64(len(data))
+	}
+	return size
+}
+
+// Sizes returns the number of bytes of every entry in f by path. Together
+// with Paths it can be used to find the fixtures that dominate TotalSize.
+func (f Fixtures) Sizes() map[string]int64 {
+	sizes := make(map[string]int64, len(f))
+	for path, data := range f {
+		sizes[path] = int64(len(data))
+	}
+	return sizes
+}
+
+// Equal returns true if a and b hold the same paths with the same contents.
+func (a Fixtures) Equal(b Fixtures) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path, aData := range a {
+		if bData, ok := b[path]; !ok || !bytes.Equal(aData, bData) {
+			return false
+		}
+	}
+	return true
+}
+
+// Hashes returns the hex encoded SHA-256 hash of the contents of every path
+// in f.
+func (f Fixtures) Hashes() map[string]string {
+	hashes := make(map[string]string, len(f))
+	for path, data := range f {
+		sum := sha256.Sum256(data)
+		hashes[path] = hex.EncodeToString(sum[:])
+	}
+	return hashes
+}
+
+// HashManifest returns a manifest of the hashes returned by f.Hashes() in
+// the format used by sha256sum, i.e. one "hash  path" line per path in
+// ascending path order. Using the manifest as a golden fixture detects
+// content changes without storing the contents themselves.
+func HashManifest(f Fixtures) []byte {
+	hashes := f.Hashes()
+	buf := &bytes.Buffer{}
+	for _, path := range f.Paths() {
+		fmt.Fprintf(buf, "%s  %s\n", hashes[path], path)
+	}
+	return buf.Bytes()
+}
+
+// Paths returns all path keys from f in ascending byte order.
+func (f Fixtures) Paths() []string {
+	sorted := make([]string, 0, len(f))
+	for p, _ := range f {
+		sorted = append(sorted, p)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+	return sorted
+}
+
+// Walk calls fn for every entry of f in the order of Paths. It stops and
+// returns the error if fn returns one. Unlike ranging over f, this makes side
+// effects of fn, e.g. writing files or logging, deterministic.
+func (f Fixtures) Walk(fn func(path string, data []byte) error) error {
+	for _, path := range f.Paths() {
+		if err := fn(path, f[path]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type Diff []*FileDiff
+
+// MarshalJSON encodes d as a JSON array of objects holding the path and kind
+// of every FileDiff. The file contents are omitted.
+func (d Diff) MarshalJSON() ([]byte, error) {
+	return d.marshalJSON(false)
+}
+
+// marshalJSON is like MarshalJSON, but includes the file contents as base64
+// if content is true.
+func (d Diff) marshalJSON(content bool) ([]byte, error) {
+	out := make([]FileDiff, 0, len(d))
+	for _, fd := range d {
+		c := *fd
+		if !content {
+			c.A, c.B = nil, nil
+		}
+		out = append(out, c)
+	}
+	return json.Marshal(out)
+}
+
+// sort sorts d by path in ascending byte order.
+func (d Diff) sort() {
+	sort.Slice(d, func(i, j int) bool {
+		return d[i].Path < d[j].Path
+	})
+}
+
+// String returns a human readable summary of d with one line per entry,
+// e.g. "missing file: a.txt", sorted by path. Unlike the error returned by
+// GoldenFixtures.Test, it never includes the content diffs.
+func (d Diff) String() string {
+	sorted := append(Diff(nil), d...)
+	sorted.sort()
+	lines := make([]string, 0, len(sorted))
+	for _, fd := range sorted {
+		lines = append(lines, fd.summary(fd.Path))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// HasChanges returns true if d has any entries.
+func (d Diff) HasChanges() bool {
+	return len(d) > 0
+}
+
+// ByKind returns the entries of d with the given kind in their original
+// order.
+func (d Diff) ByKind(k DiffKind) Diff {
+	var byKind Diff
+	for _, fd := range d {
+		if fd.Kind == k {
+			byKind = append(byKind, fd)
+		}
+	}
+	return byKind
+}
+
+// Counts returns the number of entries in d for every kind that occurs in it.
+func (d Diff) Counts() map[DiffKind]int {
+	counts := map[DiffKind]int{}
+	for _, fd := range d {
+		counts[fd.Kind]++
+	}
+	return counts
+}
+
+type FileDiff struct {
+	Path string   `json:"path"`
+	Kind DiffKind `json:"kind"`
+	A    []byte   `json:"a,omitempty"`
+	B    []byte   `json:"b,omitempty"`
+	// ModeA and ModeB hold the file modes for DiffModeChanged.
+	ModeA os.FileMode `json:"mode_a,omitempty"`
+	ModeB os.FileMode `json:"mode_b,omitempty"`
+	// OldPath holds the previous path of the file for DiffRenamed, Path holds
+	// the new one.
+	OldPath string `json:"old_path,omitempty"`
+	// Detail describes a DiffChanged reported by a Comparator.
+	Detail string `json:"detail,omitempty"`
+}
+
+// summary returns the line describing d, see Diff.String, with path
+// displayed as its path.
+func (d *FileDiff) summary(path string) string {
+	switch d.Kind {
+	case DiffUnexpected:
+		return fmt.Sprintf("unexpected file: %s", path)
+	case DiffMissing:
+		return fmt.Sprintf("missing file: %s", path)
+	case DiffChanged:
+		if d.Detail != "" && !strings.Contains(d.Detail, "\n") {
+			return fmt.Sprintf("changed file: %s (%s)", path, d.Detail)
+		} else if d.Detail == "" && (isBinary(d.A) || isBinary(d.B)) {
+			return fmt.Sprintf("changed file: %s %s", path, binarySummary(d.A, d.B))
+		}
+		return fmt.Sprintf("changed file: %s", path)
+	case DiffModeChanged:
+		return fmt.Sprintf("mode changed: %s (%04o -> %04o)", path, uint32(d.ModeA), uint32(d.ModeB))
+	case DiffRenamed:
+		return fmt.Sprintf("renamed file: %s -> %s", d.OldPath, path)
+	}
+	return fmt.Sprintf("%s: %s", d.Kind, path)
 }
 
 // DiffKind describes how a file differs between fixture a and b. See
@@ -382,4 +2665,11 @@ var (
 	DiffUnexpected DiffKind = "added"
 	// DiffChanged means that the file content in fixture a is different from b.
 	DiffChanged DiffKind = "changed"
+	// DiffModeChanged means that the file content is the same in fixture a and
+	// b, but the file mode is different. See GoldenFixtures.Modes.
+	DiffModeChanged DiffKind = "mode"
+	// DiffRenamed means that a file only present in fixture b has the same
+	// content as a file only present in fixture a, see
+	// DiffOptions.DetectRenames.
+	DiffRenamed DiffKind = "renamed"
 )
@@ -2,13 +2,22 @@ package goldy
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"syscall"
 	"testing"
+	"time"
 )
 
 var gc = EnvConfig(DefaultEnvName)
@@ -201,3 +210,3013 @@ func TestGoldenFixtures(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestBoolFlagConfig(t *testing.T) {
+	c := BoolFlagConfig("goldy-test-update")
+	if c.Flags != "" {
+		t.Fatalf("got flags=%q want none", c.Flags)
+	} else if c.Hint != "go test -goldy-test-update" {
+		t.Fatalf("got hint=%q", c.Hint)
+	}
+	for _, test := range []struct {
+		Value string
+		Want  string
+	}{{"true", "update"}, {"false", ""}, {"1", "update"}} {
+		if err := flag.Set("goldy-test-update", test.Value); err != nil {
+			t.Fatal(err)
+		} else if c.Flags != test.Want {
+			t.Errorf("%s: got flags=%q want=%q", test.Value, c.Flags, test.Want)
+		}
+	}
+	if f := flag.Lookup("goldy-test-update"); f == nil {
+		t.Fatal("flag not registered")
+	} else if b, ok := f.Value.(interface{ IsBoolFlag() bool }); !ok || !b.IsBoolFlag() {
+		t.Fatal("not a bool flag")
+	}
+
+	tmpDir := testDir(t)
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fc := (Config{Dir: tmpDir}).WithDefaults()
+	fs.Var(&updateFlag{flags: &fc.Flags}, "update", "")
+	if err := fs.Parse([]string{"-update"}); err != nil {
+		t.Fatal(err)
+	}
+	gf := fc.GoldenFixtures()
+	gf.Add([]byte("hello"), "a.txt")
+	if err := gf.Test(); err != nil {
+		t.Fatal(err)
+	} else if data, err := ioutil.ReadFile(filepath.Join(tmpDir, "a.txt")); err != nil || string(data) != "hello" {
+		t.Fatalf("got data=%q err=%v want=hello", data, err)
+	}
+}
+
+func TestConfigWith(t *testing.T) {
+	c := Config{Dir: "a", Flags: "diff", Hint: "hint"}
+	got := c.WithDir("b").WithFlags("update").WithHint("other").WithIgnoreUnexpected(true)
+	want := Config{Dir: "b", Flags: "update", Hint: "other", IgnoreUnexpected: true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%#v want=%#v", got, want)
+	}
+	if orig := (Config{Dir: "a", Flags: "diff", Hint: "hint"}); !reflect.DeepEqual(c, orig) {
+		t.Errorf("got=%#v want=%#v", c, orig)
+	}
+}
+
+func TestGoldenFixturesModes(t *testing.T) {
+	tmpDir := testDir(t)
+	name := "script.sh"
+	data := []byte("#!/bin/sh\necho hello\n")
+	if err := ioutil.WriteFile(filepath.Join(tmpDir, name), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	gf := gc.GoldenFixtures()
+	gf.Dir = tmpDir
+	gf.Flags = ""
+	gf.AddMode(data, 0700, name)
+
+	diff, err := gf.Diff()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(diff) != 1 || diff[0].Kind != DiffModeChanged {
+		t.Fatalf("got=%#v want one %s diff", diff, DiffModeChanged)
+	} else if diff[0].ModeA != 0600 || diff[0].ModeB != 0700 {
+		t.Fatalf("got modes %o -> %o want 600 -> 700", diff[0].ModeA, diff[0].ModeB)
+	}
+
+	wantErr := "mode changed: " + filepath.Join(tmpDir, name) + " (0600 -> 0700)"
+	if err := gf.Test(); err == nil || !strings.Contains(err.Error(), wantErr) {
+		t.Fatalf("got err=%v want=%s", err, wantErr)
+	}
+
+	gf.Flags = "update"
+	if err := gf.Test(); err != nil {
+		t.Fatalf("update error: %v", err)
+	} else if info, err := os.Stat(filepath.Join(tmpDir, name)); err != nil {
+		t.Fatal(err)
+	} else if info.Mode().Perm() != 0700 {
+		t.Fatalf("got mode=%o want=700", info.Mode().Perm())
+	}
+	gf.Flags = ""
+	if err := gf.Test(); err != nil {
+		t.Fatalf("re-test error: %v", err)
+	}
+}
+
+// testDir returns an empty directory for the current test that is removed
+// when the test finishes.
+func testDir(t *testing.T) string {
+	tmpDir := filepath.Join(gc.Dir, "tmp", t.Name())
+	if err := os.RemoveAll(tmpDir); err != nil {
+		t.Fatal(err)
+	} else if err := os.MkdirAll(tmpDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(tmpDir) })
+	return tmpDir
+}
+
+func TestGoldenFixturesTestResult(t *testing.T) {
+	tmpDir := testDir(t)
+	for _, name := range []string{"changed.txt", "unexpected.txt"} {
+		if err := ioutil.WriteFile(filepath.Join(tmpDir, name), []byte(name), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gf := gc.GoldenFixtures()
+	gf.Dir = tmpDir
+	gf.Flags = ""
+	gf.Add([]byte("changed"), "changed.txt")
+	gf.Add([]byte("a"), "missing-a.txt")
+	gf.Add([]byte("b"), "missing-b.txt")
+
+	r, err := gf.TestResult()
+	if err == nil {
+		t.Fatal("got err=nil")
+	} else if err.Error() != gf.Test().Error() {
+		t.Fatalf("got err=%s want=%s", err, gf.Test())
+	}
+	want := map[DiffKind]int{DiffChanged: 1, DiffMissing: 2, DiffUnexpected: 1}
+	if !reflect.DeepEqual(r.Counts, want) {
+		t.Fatalf("got=%v want=%v", r.Counts, want)
+	} else if len(r.Diff) != 4 || r.Updated {
+		t.Fatalf("got diff=%d updated=%t want diff=4 updated=false", len(r.Diff), r.Updated)
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Result
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(got.Counts, want) {
+		t.Fatalf("got=%v want=%v", got.Counts, want)
+	}
+
+	gf.Flags = "update"
+	if r, err := gf.TestResult(); err != nil {
+		t.Fatal(err)
+	} else if !r.Updated {
+		t.Fatal("got updated=false want=true")
+	}
+	gf.Flags = ""
+	if r, err := gf.TestResult(); err != nil {
+		t.Fatal(err)
+	} else if len(r.Diff) != 0 || r.Updated {
+		t.Fatalf("got diff=%d updated=%t want diff=0 updated=false", len(r.Diff), r.Updated)
+	}
+}
+
+func TestGoldenFixturesContentOnlyFailures(t *testing.T) {
+	tests := []struct {
+		Name      string
+		Disk      string
+		Add       string
+		WantErr   bool
+		WantMiss  []string
+		WantExtra []string
+	}{
+		{Name: "changed", Disk: "changed", Add: "changed again", WantErr: true},
+		{Name: "missing", Add: "missing", WantMiss: []string{"missing"}},
+		{Name: "unexpected", Disk: "unexpected", WantExtra: []string{"unexpected"}},
+	}
+
+	defer func(w io.Writer) { stderr = w }(stderr)
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			stderr = buf
+			tmpDir := testDir(t)
+			if test.Disk != "" {
+				if err := ioutil.WriteFile(filepath.Join(tmpDir, test.Name), []byte(test.Disk), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			gf := gc.GoldenFixtures()
+			gf.Dir = tmpDir
+			gf.Flags = ""
+			gf.ContentOnlyFailures = true
+			if test.Add != "" {
+				gf.Add([]byte(test.Add), test.Name)
+			}
+
+			err := gf.Test()
+			if (err != nil) != test.WantErr {
+				t.Fatalf("got err=%v want err=%t", err, test.WantErr)
+			}
+			for i, p := range test.WantMiss {
+				test.WantMiss[i] = filepath.Join(tmpDir, p)
+			}
+			for i, p := range test.WantExtra {
+				test.WantExtra[i] = filepath.Join(tmpDir, p)
+			}
+			if got := gf.MissingFiles(); !reflect.DeepEqual(got, test.WantMiss) {
+				t.Errorf("got missing=%v want=%v", got, test.WantMiss)
+			}
+			if got := gf.ExtraFiles(); !reflect.DeepEqual(got, test.WantExtra) {
+				t.Errorf("got extra=%v want=%v", got, test.WantExtra)
+			}
+			if wantLog := len(test.WantMiss) + len(test.WantExtra); strings.Count(buf.String(), "\n") != wantLog {
+				t.Errorf("got log=%q want %d lines", buf.String(), wantLog)
+			}
+		})
+	}
+}
+
+func TestGoldenFixturesContentOnlyFailuresSubtests(t *testing.T) {
+	c := TempConfig(t)
+	for _, name := range []string{"e1.txt", "e2.txt"} {
+		if err := ioutil.WriteFile(filepath.Join(c.Dir, name), []byte("extra"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	buf := &bytes.Buffer{}
+	gf := c.GoldenFixtures()
+	gf.Output = buf
+	gf.Flags = string(FlagStats)
+	gf.ContentOnlyFailures = true
+	gf.Add([]byte("m1"), "m1.txt")
+	gf.Add([]byte("m2"), "m2.txt")
+	r := &fakeRunner{results: map[string]string{}}
+	gf.runSubtests(r)
+	for name, got := range r.results {
+		if got != "" {
+			t.Errorf("%s: got=%q want none", name, got)
+		}
+	}
+
+	wantMiss := []string{filepath.Join(c.Dir, "m1.txt"), filepath.Join(c.Dir, "m2.txt")}
+	wantExtra := []string{filepath.Join(c.Dir, "e1.txt"), filepath.Join(c.Dir, "e2.txt")}
+	if got := gf.MissingFiles(); !reflect.DeepEqual(got, wantMiss) {
+		t.Errorf("got missing=%v want=%v", got, wantMiss)
+	}
+	if got := gf.ExtraFiles(); !reflect.DeepEqual(got, wantExtra) {
+		t.Errorf("got extra=%v want=%v", got, wantExtra)
+	}
+	if !strings.Contains(buf.String(), "goldy: stats: dir="+c.Dir+" fixtures=2 ") {
+		t.Errorf("got log=%q want stats", buf.String())
+	}
+}
+
+func TestGoldenFixturesJSON(t *testing.T) {
+	tmpDir := testDir(t)
+	for _, name := range []string{"changed.txt", "unexpected.txt"} {
+		if err := ioutil.WriteFile(filepath.Join(tmpDir, name), []byte(name), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gf := gc.GoldenFixtures()
+	gf.Dir = tmpDir
+	gf.Add([]byte("changed"), "changed.txt")
+	gf.Add([]byte("missing"), "missing.txt")
+
+	defer func(w io.Writer) { stdout = w }(stdout)
+	defer func(w io.Writer) { stderr = w }(stderr)
+	stderr = ioutil.Discard
+	tests := []struct {
+		Flags string
+		Want  []map[string]interface{}
+	}{
+		{
+			Flags: "json",
+			Want: []map[string]interface{}{
+				{"path": filepath.Join(tmpDir, "changed.txt"), "kind": "changed"},
+				{"path": filepath.Join(tmpDir, "missing.txt"), "kind": "missing"},
+				{"path": filepath.Join(tmpDir, "unexpected.txt"), "kind": "added"},
+			},
+		},
+		{
+			Flags: "json,verbose",
+			Want: []map[string]interface{}{
+				{"path": filepath.Join(tmpDir, "changed.txt"), "kind": "changed", "a": "Y2hhbmdlZC50eHQ=", "b": "Y2hhbmdlZA=="},
+				{"path": filepath.Join(tmpDir, "missing.txt"), "kind": "missing", "b": "bWlzc2luZw=="},
+				{"path": filepath.Join(tmpDir, "unexpected.txt"), "kind": "added", "a": "dW5leHBlY3RlZC50eHQ="},
+			},
+		},
+	}
+	for _, test := range tests {
+		buf := &bytes.Buffer{}
+		stdout = buf
+		gf.Flags = test.Flags
+		if err := gf.Test(); err == nil {
+			t.Errorf("%s: got err=nil", test.Flags)
+		}
+		var got []map[string]interface{}
+		if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+			t.Errorf("%s: %s", test.Flags, err)
+		} else if !reflect.DeepEqual(got, test.Want) {
+			t.Errorf("%s: got=%v want=%v", test.Flags, got, test.Want)
+		}
+	}
+}
+
+func Test_textDiffColor(t *testing.T) {
+	a := []byte("one\ntwo\nthree\n")
+	b := []byte("one\n2\nthree\nfour\n")
+	plain := textDiff(a, b, DefaultDiffContext, false)
+	colored := textDiff(a, b, DefaultDiffContext, true)
+	if !strings.Contains(colored, ansiGreen+"+2"+ansiReset) {
+		t.Errorf("missing green added line: %q", colored)
+	} else if !strings.Contains(colored, ansiRed+"-two"+ansiReset) {
+		t.Errorf("missing red removed line: %q", colored)
+	}
+	ansi := regexp.MustCompile("\x1b\\[[0-9]+m")
+	if got := ansi.ReplaceAllString(colored, ""); got != plain {
+		t.Errorf("got=%q want=%q", got, plain)
+	}
+}
+
+func Test_hexDiff(t *testing.T) {
+	a := []byte("0123456789abcdef0123456789abcdef\xff")
+	b := []byte("0123456789abcdef0123456789abCdef")
+	want := strings.Join([]string{
+		"-00000010  30 31 32 33 34 35 36 37 38 39 61 62 63 64 65 66  |0123456789abcdef|",
+		"+00000010  30 31 32 33 34 35 36 37 38 39 61 62 43 64 65 66  |0123456789abCdef|",
+		"-00000020  ff                                               |.|",
+	}, "\n")
+	if got := hexDiff(a, b); got != want {
+		t.Fatalf("got=\n%s\nwant=\n%s", got, want)
+	}
+}
+
+func Test_textDiffHex(t *testing.T) {
+	long := bytes.Repeat([]byte("x"), maxDiffLineLength+1)
+	longChanged := append(append([]byte(nil), long...), 'y')
+	tests := []struct {
+		Name string
+		A    []byte
+		B    []byte
+		Hex  bool
+	}{
+		{Name: "short without newline", A: []byte("a"), B: []byte("b")},
+		{Name: "lines", A: []byte("a\nb\n"), B: []byte("a\nc\n")},
+		{Name: "no newline", A: long, B: longChanged, Hex: true},
+		{Name: "long last line", A: append([]byte("a\n"), long...), B: []byte("a\n"), Hex: true},
+		{Name: "invalid utf-8", A: []byte("caf\xe9\n"), B: []byte("cafe\n"), Hex: true},
+	}
+	for _, test := range tests {
+		got := textDiff(test.A, test.B, DefaultDiffContext, false)
+		if want := hexDiff(test.A, test.B); test.Hex && got != indent(want) {
+			t.Errorf("%s: got=%q want=%q", test.Name, got, indent(want))
+		} else if !test.Hex && !strings.HasPrefix(got, "  @@ ") {
+			t.Errorf("%s: got=%q want unified diff", test.Name, got)
+		}
+	}
+}
+
+func TestGoldenFixturesDiffContext(t *testing.T) {
+	var old, new []string
+	for i := 1; i <= 20; i++ {
+		old = append(old, strconv.Itoa(i))
+		new = append(new, strconv.Itoa(i))
+	}
+	new[9] = "ten"
+	c := TempConfig(t)
+	if err := ioutil.WriteFile(filepath.Join(c.Dir, "a.txt"), []byte(strings.Join(old, "\n")+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		Context int
+		Want    string
+	}{
+		{0, "  @@ -7,7 +7,7 @@\n   7\n   8\n   9\n  -10\n  +ten\n   11\n   12\n   13"},
+		{1, "  @@ -9,3 +9,3 @@\n   9\n  -10\n  +ten\n   11"},
+		{3, "  @@ -7,7 +7,7 @@\n   7\n   8\n   9\n  -10\n  +ten\n   11\n   12\n   13"},
+		{10, "  @@ -1,20 +1,20 @@\n   1\n   2\n   3\n   4\n   5\n   6\n   7\n   8\n   9\n  -10\n  +ten\n   11\n   12\n   13\n   14\n   15\n   16\n   17\n   18\n   19\n   20"},
+	}
+	for _, test := range tests {
+		gf := c.GoldenFixtures()
+		gf.DiffContext = test.Context
+		gf.Add([]byte(strings.Join(new, "\n")+"\n"), "a.txt")
+		want := "1 errors:\nchanged file: " + filepath.Join(c.Dir, "a.txt") + "\n" + test.Want
+		if err := gf.Test(); err == nil || err.Error() != want {
+			t.Errorf("%d: got err=%v want=%s", test.Context, err, want)
+		}
+	}
+
+	gf := c.GoldenFixtures()
+	gf.DiffContext = -1
+	if err := gf.Test(); err == nil || err.Error() != "negative diff context: -1" {
+		t.Fatalf("got err=%v", err)
+	}
+}
+
+func TestGoldenFixturesColor(t *testing.T) {
+	tmpDir := testDir(t)
+	if err := ioutil.WriteFile(filepath.Join(tmpDir, "a.txt"), []byte("a\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	gf := gc.GoldenFixtures()
+	gf.Dir = tmpDir
+	gf.Flags = "diff,color"
+	gf.Add([]byte("b\n"), "a.txt")
+
+	defer func(fn func(*os.File) bool) { isTerminal = fn }(isTerminal)
+	defer os.Setenv("NO_COLOR", os.Getenv("NO_COLOR"))
+	tests := []struct {
+		Terminal  bool
+		NoColor   string
+		WantColor bool
+	}{
+		{Terminal: true, WantColor: true},
+		{Terminal: true, NoColor: "1"},
+		{Terminal: false},
+	}
+	for _, test := range tests {
+		isTerminal = func(*os.File) bool { return test.Terminal }
+		os.Setenv("NO_COLOR", test.NoColor)
+		err := gf.Test()
+		if err == nil {
+			t.Fatal("got err=nil")
+		} else if got := strings.Contains(err.Error(), ansiReset); got != test.WantColor {
+			t.Errorf("terminal=%t NO_COLOR=%q: got color=%t want=%t", test.Terminal, test.NoColor, got, test.WantColor)
+		}
+	}
+}
+
+func TestGoldenFixturesDiffBudget(t *testing.T) {
+	tmpDir := testDir(t)
+	gf := gc.GoldenFixtures()
+	gf.Dir = tmpDir
+	gf.Flags = "diff"
+	gf.DiffBudget = 10 * time.Millisecond
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if err := ioutil.WriteFile(filepath.Join(tmpDir, name), []byte("old\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		gf.Add([]byte("new\n"), name)
+	}
+
+	defer func(fn func([]byte, []byte, int, bool) string) { renderDiff = fn }(renderDiff)
+	renderDiff = func(a, b []byte, context int, color bool) string {
+		time.Sleep(gf.DiffBudget)
+		return textDiff(a, b, context, color)
+	}
+	err := gf.Test()
+	if err == nil {
+		t.Fatal("got err=nil")
+	}
+	msg := err.Error()
+	if got := strings.Count(msg, "+new"); got != 1 {
+		t.Errorf("got %d diffs want 1: %s", got, msg)
+	} else if got := strings.Count(msg, "(diff omitted)"); got != 2 {
+		t.Errorf("got %d omitted diffs want 2: %s", got, msg)
+	} else if !strings.Contains(msg, "diff budget of 10ms exceeded, omitted 2 diffs") {
+		t.Errorf("missing budget note: %s", msg)
+	}
+}
+
+func TestGoldenUpdate(t *testing.T) {
+	c := gc
+	c.Dir = testDir(t)
+	tests := []struct {
+		Flags   string
+		Data    string
+		WantErr string
+	}{
+		{Data: "a", WantErr: "missing file: " + filepath.Join(c.Dir, "a.txt")},
+		{Flags: "update", Data: "a"},
+		{Data: "a"},
+		{Data: "b", WantErr: "changed file: " + filepath.Join(c.Dir, "a.txt")},
+		{Flags: "update", Data: "b"},
+		{Data: "b"},
+	}
+	for i, test := range tests {
+		c.Flags = test.Flags
+		tb := &fakeTB{}
+		c.Golden(tb, []byte(test.Data), "a.txt")
+		if test.WantErr == "" && tb.fatal != "" {
+			t.Errorf("%d: got fatal=%s want none", i, tb.fatal)
+		} else if !strings.Contains(tb.fatal, test.WantErr) {
+			t.Errorf("%d: got fatal=%q want=%q", i, tb.fatal, test.WantErr)
+		}
+	}
+}
+
+func TestGoldenStream(t *testing.T) {
+	c := gc
+	c.Dir = testDir(t)
+	path := filepath.Join(c.Dir, "out.txt")
+	c.Flags = ""
+	if err := c.GoldenStream(bytes.NewReader([]byte("a\n")), "out.txt"); err == nil || !strings.Contains(err.Error(), "missing file: "+path) {
+		t.Fatalf("got err=%v", err)
+	}
+	c.Flags = string(FlagUpdate)
+	if err := c.GoldenStream(bytes.NewReader([]byte("a\n")), "out.txt"); err != nil {
+		t.Fatal(err)
+	}
+	c.Flags = ""
+	if err := c.GoldenStream(bytes.NewReader([]byte("a\n")), "out.txt"); err != nil {
+		t.Fatal(err)
+	} else if err := c.GoldenStream(bytes.NewReader([]byte("b\n")), "out.txt"); err == nil || !strings.Contains(err.Error(), "changed file: "+path) {
+		t.Fatalf("got err=%v", err)
+	}
+
+	// A failed read is not a diff and doesn't update the golden fixture.
+	wantErr := errors.New("broken pipe")
+	c.Flags = string(FlagUpdate)
+	err := c.GoldenStream(io.MultiReader(strings.NewReader("partial"), errReader{wantErr}), "out.txt")
+	if !errors.Is(err, wantErr) || err.Error() != "failed to read stream: broken pipe" {
+		t.Fatalf("got err=%v want=%v", err, wantErr)
+	} else if data, err := ioutil.ReadFile(path); err != nil {
+		t.Fatal(err)
+	} else if string(data) != "a\n" {
+		t.Fatalf("got=%q want=%q", data, "a\n")
+	}
+}
+
+// fakeTB records calls to Fatal instead of stopping the test.
+type fakeTB struct {
+	testing.TB
+	fatal string
+}
+
+func (f *fakeTB) Helper() {}
+
+func (f *fakeTB) Fatal(args ...interface{}) {
+	f.fatal = fmt.Sprint(args...)
+}
+
+func (f *fakeTB) Fatalf(format string, args ...interface{}) {
+	f.fatal = fmt.Sprintf(format, args...)
+}
+
+func TestGolden(t *testing.T) {
+	c := gc
+	c.Dir = testDir(t)
+	if err := ioutil.WriteFile(filepath.Join(c.Dir, "a.txt"), []byte("a"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		Data    string
+		WantErr string
+	}{
+		{Data: "a"},
+		{Data: "b", WantErr: "changed file: " + filepath.Join(c.Dir, "a.txt")},
+		{Data: "b", WantErr: c.Hint},
+	}
+	for i, test := range tests {
+		tb := &fakeTB{}
+		c.Golden(tb, []byte(test.Data), "a.txt")
+		if test.WantErr == "" && tb.fatal != "" {
+			t.Errorf("%d: got fatal=%s want none", i, tb.fatal)
+		} else if !strings.Contains(tb.fatal, test.WantErr) {
+			t.Errorf("%d: got fatal=%q want=%q", i, tb.fatal, test.WantErr)
+		}
+	}
+}
+
+func TestGoldenValue(t *testing.T) {
+	type point struct {
+		X, Y int
+		Tags []string `json:"tags,omitempty"`
+	}
+	c := gc
+	c.Dir = testDir(t)
+	want := "{\n  \"X\": 1,\n  \"Y\": 2,\n  \"tags\": [\n    \"a\"\n  ]\n}\n"
+	if err := ioutil.WriteFile(filepath.Join(c.Dir, "point.json"), []byte(want), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		Value   interface{}
+		Encoder func(interface{}) ([]byte, error)
+		WantErr string
+	}{
+		{Value: point{X: 1, Y: 2, Tags: []string{"a"}}},
+		{Value: &point{X: 1, Y: 2, Tags: []string{"a"}}},
+		{Value: point{X: 1, Y: 3}, WantErr: "changed file: " + filepath.Join(c.Dir, "point.json")},
+		{Value: make(chan int), WantErr: "failed to encode value: json: unsupported type: chan int"},
+		{
+			Value: point{X: 1},
+			Encoder: func(v interface{}) ([]byte, error) {
+				return []byte(want), nil
+			},
+		},
+	}
+	for i, test := range tests {
+		tb := &fakeTB{}
+		c.Encoder = test.Encoder
+		c.GoldenValue(tb, test.Value, "point.json")
+		if test.WantErr == "" && tb.fatal != "" {
+			t.Errorf("%d: got fatal=%s want none", i, tb.fatal)
+		} else if !strings.Contains(tb.fatal, test.WantErr) {
+			t.Errorf("%d: got fatal=%q want=%q", i, tb.fatal, test.WantErr)
+		}
+	}
+}
+
+func TestExcludeGlob(t *testing.T) {
+	exclude := ExcludeAny(IsDotfile, ExcludeGlob("*.tmp", "Thumbs.db"))
+	tests := []struct {
+		Path string
+		Want bool
+	}{
+		{Path: "a/b.txt", Want: false},
+		{Path: "a/.DS_Store", Want: true},
+		{Path: "a/b.tmp", Want: true},
+		{Path: "a.tmp/b.txt", Want: false},
+		{Path: "a/Thumbs.db", Want: true},
+		{Path: "a/thumbs.db", Want: false},
+	}
+	for _, test := range tests {
+		if got := exclude(test.Path); got != test.Want {
+			t.Errorf("%s: got=%t want=%t", test.Path, got, test.Want)
+		}
+	}
+
+	if ExcludeAny()("a.txt") {
+		t.Error("ExcludeAny() excluded a.txt")
+	}
+
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), `"[a"`) {
+			t.Errorf("got panic=%v want bad pattern panic", r)
+		}
+	}()
+	ExcludeGlob("*.txt", "[a")
+}
+
+func Test_binarySummary(t *testing.T) {
+	tests := []struct {
+		A, B string
+		Want string
+	}{
+		{A: "\x00abc", B: "\x00abc", Want: "(4 -> 4 bytes, 0 bytes differ)"},
+		{A: "\x00abc", B: "\x00axc", Want: "(4 -> 4 bytes, 1 bytes differ)"},
+		{A: "\x00abc", B: "\x00axcde", Want: "(4 -> 6 bytes, 3 bytes differ)"},
+		{A: "\x00abcde", B: "\x00a", Want: "(6 -> 2 bytes, 4 bytes differ)"},
+	}
+	for _, test := range tests {
+		if got := binarySummary([]byte(test.A), []byte(test.B)); got != test.Want {
+			t.Errorf("%q -> %q: got=%s want=%s", test.A, test.B, got, test.Want)
+		}
+	}
+}
+
+func TestGoldenFixturesBinaryDiff(t *testing.T) {
+	tmpDir := testDir(t)
+	files := map[string][2]string{
+		"text.txt":  {"one\ntwo\n", "one\n2\n"},
+		"image.png": {"\x89PNG\x00\x01", "\x89PNG\x00\x02\x03"},
+	}
+	gf := gc.GoldenFixtures()
+	gf.Dir = tmpDir
+	gf.Flags = "diff"
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(tmpDir, name), []byte(data[0]), 0600); err != nil {
+			t.Fatal(err)
+		}
+		gf.Add([]byte(data[1]), name)
+	}
+
+	err := gf.Test()
+	if err == nil {
+		t.Fatal("got err=nil")
+	}
+	want := []string{
+		"changed file: " + filepath.Join(tmpDir, "image.png") + " (6 -> 7 bytes, 2 bytes differ)\n",
+		"changed file: " + filepath.Join(tmpDir, "text.txt") + "\n",
+		"  -two\n  +2\n",
+	}
+	for _, w := range want {
+		if !strings.Contains(err.Error(), w) {
+			t.Errorf("got=%s want=%q", err, w)
+		}
+	}
+}
+
+func TestGoldenFixturesCapture(t *testing.T) {
+	gf := gc.GoldenFixtures("tmp")
+	if err := gf.Capture(func(w io.Writer) error {
+		_, err := io.WriteString(w, "hello")
+		return err
+	}, "ok.txt"); err != nil {
+		t.Fatal(err)
+	}
+	wantErr := errors.New("encode error")
+	if err := gf.Capture(func(w io.Writer) error {
+		io.WriteString(w, "partial")
+		return wantErr
+	}, "error.txt"); err != wantErr {
+		t.Fatalf("got err=%v want=%v", err, wantErr)
+	}
+	want := Fixtures{filepath.Join(gc.Dir, "tmp", "ok.txt"): []byte("hello")}
+	if !reflect.DeepEqual(gf.Fixtures, want) {
+		t.Fatalf("got=%#v want=%#v", gf.Fixtures, want)
+	}
+}
+
+func TestGoldenFixturesDryRun(t *testing.T) {
+	tmpDir := testDir(t)
+	files := map[string]string{
+		"changed.txt":    "data for: changed.txt",
+		"unexpected.txt": "data for: unexpected.txt",
+		"mode.sh":        "data for: mode.sh",
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(tmpDir, name), []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gf := gc.GoldenFixtures()
+	gf.Dir = tmpDir
+	gf.Flags = "update,dry-run"
+	gf.Add([]byte("changed"), "changed.txt")
+	gf.Add([]byte("missing"), "missing.txt")
+	gf.AddMode([]byte(files["mode.sh"]), 0700, "mode.sh")
+
+	err := gf.Test()
+	if err == nil {
+		t.Fatal("got err=nil")
+	}
+	want := strings.Join([]string{
+		"dry-run: 4 planned operations:",
+		"create: " + filepath.Join(tmpDir, "missing.txt"),
+		"overwrite: " + filepath.Join(tmpDir, "changed.txt"),
+		"chmod: " + filepath.Join(tmpDir, "mode.sh"),
+		"delete: " + filepath.Join(tmpDir, "unexpected.txt"),
+	}, "\n")
+	if err.Error() != want {
+		t.Fatalf("got=%s\nwant=%s", err, want)
+	}
+
+	got, err := Load(tmpDir, IsDotfile)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(got) != len(files) {
+		t.Fatalf("dry-run modified files: %v", got.Paths())
+	}
+	for name, data := range files {
+		if string(got[filepath.Join(tmpDir, name)]) != data {
+			t.Errorf("dry-run modified %s", name)
+		}
+	}
+
+	gf.Flags = "update"
+	if err := gf.Test(); err != nil {
+		t.Fatal(err)
+	}
+	gf.Flags = "update,dry-run"
+	if err := gf.Test(); err != nil {
+		t.Fatalf("got err=%v want=nil", err)
+	}
+}
+
+func TestGoldenFixturesPruneDirs(t *testing.T) {
+	tests := []struct {
+		Name          string
+		KeepEmptyDirs bool
+		Dotfile       bool
+		WantDir       bool
+	}{
+		{Name: "prune"},
+		{Name: "keep", KeepEmptyDirs: true, WantDir: true},
+		{Name: "dotfile", Dotfile: true, WantDir: true},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			tmpDir := testDir(t)
+			nested := filepath.Join(tmpDir, "a", "b")
+			if err := os.MkdirAll(nested, 0700); err != nil {
+				t.Fatal(err)
+			} else if err := ioutil.WriteFile(filepath.Join(nested, "c.txt"), nil, 0600); err != nil {
+				t.Fatal(err)
+			}
+			if test.Dotfile {
+				if err := ioutil.WriteFile(filepath.Join(nested, ".keep"), nil, 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			c := gc
+			c.Dir = tmpDir
+			c.Flags = "update"
+			c.KeepEmptyDirs = test.KeepEmptyDirs
+			if err := c.GoldenFixtures().Test(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(filepath.Join(nested, "c.txt")); !os.IsNotExist(err) {
+				t.Fatalf("got err=%v want not exist", err)
+			}
+			_, err := os.Stat(nested)
+			if gotDir := err == nil; gotDir != test.WantDir {
+				t.Fatalf("got dir=%t want=%t", gotDir, test.WantDir)
+			}
+			if _, err := os.Stat(tmpDir); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestGoldenFixturesExpect(t *testing.T) {
+	for _, flags := range []string{"", string(FlagUpdate)} {
+		gf := gc.GoldenFixtures()
+		gf.Dir = testDir(t)
+		gf.Flags = flags
+		gf.Expect("a.txt", "sub/b.txt", "c.txt")
+		gf.Add([]byte("a"), "a.txt")
+
+		err := gf.Test()
+		want := "2 expected fixtures were not added:\n" +
+			"not added: " + gf.join("c.txt") + "\n" +
+			"not added: " + gf.join("sub/b.txt")
+		if err == nil || !strings.HasPrefix(err.Error(), want) {
+			t.Fatalf("%q: got err=%v want=%s", flags, err, want)
+		} else if _, err := os.Stat(filepath.Join(gf.Dir, "a.txt")); !os.IsNotExist(err) {
+			t.Fatalf("%q: got err=%v want not exist", flags, err)
+		}
+
+		gf.Add([]byte("b"), "sub", "b.txt")
+		gf.Add([]byte("c"), "c.txt")
+		gf.Flags = string(FlagUpdate)
+		if err := gf.Test(); err != nil {
+			t.Fatalf("%q: got err=%v want=nil", flags, err)
+		}
+	}
+}
+
+func TestGoldenFixturesDisplayDir(t *testing.T) {
+	c := TempConfig(t)
+	c.DisplayDir = c.Dir
+	gf := c.GoldenFixtures("out", "nested")
+	gf.Add([]byte("a"), "a.txt")
+	gf.Add([]byte("b"), "sub", "b.txt")
+
+	want := "2 errors:\n" +
+		"missing file: out/nested/a.txt\n" +
+		"missing file: out/nested/sub/b.txt"
+	if err := gf.Test(); err == nil || !strings.HasPrefix(err.Error(), want) {
+		t.Fatalf("got err=%v want=%s", err, want)
+	} else if diff, err := gf.Diff(); err != nil {
+		t.Fatal(err)
+	} else if got, want := diff[0].Path, gf.join("a.txt"); got != want {
+		t.Fatalf("got=%s want=%s", got, want)
+	}
+
+	// Paths outside of DisplayDir are displayed unmodified.
+	gf.DisplayDir = filepath.Join(c.Dir, "other")
+	want = "2 errors:\nmissing file: " + gf.join("a.txt") + "\n"
+	if err := gf.Test(); err == nil || !strings.HasPrefix(err.Error(), want) {
+		t.Fatalf("got err=%v want=%s", err, want)
+	}
+}
+
+func TestGoldenFixturesOnUpdate(t *testing.T) {
+	c := TempConfig(t)
+	var got []string
+	c.OnUpdate = func(written []string) error {
+		got = append(got, written...)
+		return nil
+	}
+	if err := ioutil.WriteFile(filepath.Join(c.Dir, "same.txt"), []byte("same"), 0600); err != nil {
+		t.Fatal(err)
+	} else if err := ioutil.WriteFile(filepath.Join(c.Dir, "unexpected.txt"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	gf := c.GoldenFixtures()
+	gf.Flags = string(FlagUpdate)
+	gf.Add([]byte("same"), "same.txt")
+	gf.Add([]byte("b"), "sub", "b.txt")
+	gf.Add([]byte("a"), "a.txt")
+	if err := gf.Test(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(c.Dir, "a.txt"), filepath.Join(c.Dir, "sub", "b.txt")}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got=%v want=%v", got, want)
+	}
+
+	// Nothing was written, so the hook is not called.
+	got = nil
+	if err := gf.Test(); err != nil {
+		t.Fatal(err)
+	} else if got != nil {
+		t.Fatalf("got=%v want=nil", got)
+	}
+
+	hookErr := errors.New("gofmt failed")
+	gf.OnUpdate = func(written []string) error { return hookErr }
+	gf.Add([]byte("c"), "c.txt")
+	if err := gf.Test(); !errors.Is(err, hookErr) {
+		t.Fatalf("got=%v want=%v", err, hookErr)
+	} else if want := "on update: gofmt failed"; err.Error() != want {
+		t.Fatalf("got=%q want=%q", err, want)
+	}
+}
+
+func TestGoldenFixturesConfirmThreshold(t *testing.T) {
+	c := TempConfig(t)
+	c.ConfirmThreshold = 2
+	newGf := func(flags string, n int) *GoldenFixtures {
+		gf := c.GoldenFixtures()
+		gf.Flags = flags
+		for i := 0; i < n; i++ {
+			gf.Add([]byte("data"), fmt.Sprintf("%d.txt", i))
+		}
+		return gf
+	}
+
+	err := newGf(string(FlagUpdate), 3).Test()
+	want := fmt.Sprintf(
+		"update would modify 3 files in %s (0 changed, 3 missing, 0 unexpected), more than the confirm threshold of 2\n\nadd the \"force\" flag to update them anyway",
+		c.Dir,
+	)
+	if err == nil || err.Error() != want {
+		t.Fatalf("got err=%v want=%s", err, want)
+	} else if f, err := Load(c.Dir, IsDotfile); err != nil || len(f) != 0 {
+		t.Fatalf("got=%v err=%v want no files", f.Paths(), err)
+	}
+
+	if err := newGf(string(FlagUpdate), 2).Test(); err != nil {
+		t.Fatalf("got err=%v want=nil", err)
+	} else if err := newGf("update,force", 5).Test(); err != nil {
+		t.Fatalf("got err=%v want=nil", err)
+	}
+
+	// FlagClean is guarded as well.
+	if err := newGf(string(FlagClean), 0).Test(); err == nil || !strings.HasPrefix(err.Error(), "update would modify 5 files") {
+		t.Fatalf("got err=%v", err)
+	} else if err := newGf("clean,force", 0).Test(); err != nil {
+		t.Fatalf("got err=%v want=nil", err)
+	}
+
+	// RunSubtests checks the whole update, not every file on its own.
+	r := &fakeRunner{results: map[string]string{}}
+	newGf(string(FlagUpdate), 3).runSubtests(r)
+	if !strings.HasPrefix(r.fatal, "update would modify 3 files") {
+		t.Fatalf("got=%q", r.fatal)
+	} else if len(r.results) != 0 {
+		t.Fatalf("got=%v want no subtests", r.results)
+	} else if f, err := Load(c.Dir, IsDotfile); err != nil || len(f) != 0 {
+		t.Fatalf("got=%v err=%v want no files", f.Paths(), err)
+	}
+
+	// So does FlagRewrite, which removes 2 files and writes 3.
+	if err := newGf("update,force", 2).Test(); err != nil {
+		t.Fatal(err)
+	}
+	gf := c.GoldenFixtures()
+	gf.Flags = string(FlagRewrite)
+	for i := 2; i < 5; i++ {
+		gf.Add([]byte("data"), fmt.Sprintf("%d.txt", i))
+	}
+	if err := gf.Test(); err == nil || !strings.HasPrefix(err.Error(), "update would modify 5 files in "+c.Dir+" (0 changed, 3 missing, 2 unexpected)") {
+		t.Fatalf("got err=%v", err)
+	} else if f, err := Load(c.Dir, IsDotfile); err != nil || len(f) != 2 {
+		t.Fatalf("got=%v err=%v want 2 files", f.Paths(), err)
+	}
+	gf.Flags = "rewrite,force"
+	if err := gf.Test(); err != nil {
+		t.Fatalf("got err=%v want=nil", err)
+	}
+}
+
+func TestGoldenFixturesArtifactsDir(t *testing.T) {
+	c := TempConfig(t)
+	c.ArtifactsDir = filepath.Join(c.Dir, "artifacts")
+	if err := ioutil.WriteFile(filepath.Join(c.Dir, "same.txt"), []byte("same"), 0600); err != nil {
+		t.Fatal(err)
+	} else if err := os.MkdirAll(filepath.Join(c.Dir, "golden"), 0700); err != nil {
+		t.Fatal(err)
+	} else if err := ioutil.WriteFile(filepath.Join(c.Dir, "golden", "changed.txt"), []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	gf := c.GoldenFixtures()
+	gf.IgnoreUnexpected = true
+	gf.Add([]byte("same"), "same.txt")
+	if err := gf.Test(); err != nil {
+		t.Fatal(err)
+	} else if _, err := os.Stat(c.ArtifactsDir); !os.IsNotExist(err) {
+		t.Fatalf("got err=%v want not exist", err)
+	}
+
+	gf = c.GoldenFixtures("golden")
+	gf.Add([]byte("new"), "changed.txt")
+	gf.Add([]byte("missing"), "sub", "missing.txt")
+	err := gf.Test()
+	want := "the actual data of the files above was written to: " + c.ArtifactsDir
+	if err == nil || !strings.HasSuffix(err.Error(), want) {
+		t.Fatalf("got err=%v want suffix=%s", err, want)
+	}
+	got, err := Load(c.ArtifactsDir, IsDotfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mirror := filepath.Join(c.ArtifactsDir, artifactPath(gf.Dir))
+	wantFiles := Fixtures{
+		fixtureKey(filepath.Join(mirror, "changed.txt")):        []byte("new"),
+		fixtureKey(filepath.Join(mirror, "sub", "missing.txt")): []byte("missing"),
+	}
+	if !reflect.DeepEqual(got, wantFiles) {
+		t.Fatalf("got=%v want=%v", got.Paths(), wantFiles.Paths())
+	} else if data, err := ioutil.ReadFile(filepath.Join(c.Dir, "golden", "changed.txt")); err != nil {
+		t.Fatal(err)
+	} else if string(data) != "old" {
+		t.Fatalf("got=%q want=%q", data, "old")
+	}
+}
+
+func TestArtifactPath(t *testing.T) {
+	tests := []struct {
+		Path string
+		Want string
+	}{
+		{"test-fixtures/out/a.txt", "test-fixtures/out/a.txt"},
+		{"/tmp/x/a.txt", "tmp/x/a.txt"},
+		{"../../a.txt", "a.txt"},
+	}
+	for _, test := range tests {
+		if got := artifactPath(test.Path); got != test.Want {
+			t.Errorf("got=%q want=%q", got, test.Want)
+		}
+	}
+}
+
+func TestGoldenFixturesClean(t *testing.T) {
+	tmpDir := testDir(t)
+	files := map[string]string{
+		"changed.txt":        "old",
+		"same.txt":           "same",
+		"unexpected.txt":     "unexpected",
+		"sub/unexpected.txt": "unexpected",
+		".dotfile":           "excluded",
+	}
+	for name, data := range files {
+		path := filepath.Join(tmpDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		} else if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	newGf := func() *GoldenFixtures {
+		gf := gc.GoldenFixtures()
+		gf.Dir = tmpDir
+		gf.Flags = string(FlagClean)
+		gf.Add([]byte("new"), "changed.txt")
+		gf.Add([]byte("same"), "same.txt")
+		gf.Add([]byte("missing"), "missing.txt")
+		return gf
+	}
+
+	r, err := newGf().TestResult()
+	if err == nil || !strings.HasPrefix(err.Error(), "2 errors:\nchanged file: ") ||
+		!strings.Contains(err.Error(), "missing file: "+filepath.Join(tmpDir, "missing.txt")) {
+		t.Fatalf("got err=%v", err)
+	} else if !r.Updated {
+		t.Fatalf("got=%v want=%v", r.Updated, true)
+	}
+	got, err := Load(tmpDir, func(string) bool { return false })
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantFiles := Fixtures{
+		filepath.Join(tmpDir, ".dotfile"):    []byte("excluded"),
+		filepath.Join(tmpDir, "changed.txt"): []byte("old"),
+		filepath.Join(tmpDir, "same.txt"):    []byte("same"),
+	}
+	if diff := got.Diff(wantFiles); len(diff) > 0 {
+		t.Fatalf("unexpected files after clean:\n%s", diff)
+	} else if _, err := os.Stat(filepath.Join(tmpDir, "sub")); !os.IsNotExist(err) {
+		t.Fatalf("got err=%v want=%v", err, os.ErrNotExist)
+	}
+
+	// Without unexpected files, nothing is updated.
+	if r, _ := newGf().TestResult(); r.Updated {
+		t.Fatalf("got=%v want=%v", r.Updated, false)
+	}
+
+	// IgnoreUnexpected leaves unexpected files alone.
+	if err := ioutil.WriteFile(filepath.Join(tmpDir, "unexpected.txt"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	gf := newGf()
+	gf.IgnoreUnexpected = true
+	gf.Test()
+	if _, err := os.Stat(filepath.Join(tmpDir, "unexpected.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	// FlagDryRun only reports the files that would be deleted.
+	gf = newGf()
+	gf.Flags = string(FlagClean) + "," + string(FlagDryRun)
+	want := "dry-run: 1 planned operations:\ndelete: " + filepath.Join(tmpDir, "unexpected.txt")
+	if r, err := gf.TestResult(); err == nil || err.Error() != want {
+		t.Fatalf("got err=%v want=%v", err, want)
+	} else if r.Updated {
+		t.Fatalf("got=%v want=%v", r.Updated, false)
+	} else if _, err := os.Stat(filepath.Join(tmpDir, "unexpected.txt")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGoldenFixturesUpdatePlan(t *testing.T) {
+	c := TempConfig(t)
+	c.VerifyChecksums = true
+	files := map[string]string{
+		"changed.txt":    "old",
+		"unexpected.txt": "unexpected",
+		"mode.sh":        "mode",
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(c.Dir, name), []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A manifest that doesn't match would fail Diff, but not an update.
+	if err := ioutil.WriteFile(c.Dir+".sha256", nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	gf := c.GoldenFixtures()
+	gf.Add([]byte("new"), "changed.txt")
+	gf.Add([]byte("missing"), "missing.txt")
+	gf.AddMode([]byte("mode"), 0700, "mode.sh")
+
+	plan, err := gf.UpdatePlan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]DiffKind{}
+	for _, d := range plan {
+		got[filepath.Base(d.Path)] = d.Kind
+	}
+	want := map[string]DiffKind{
+		"changed.txt":    DiffChanged,
+		"missing.txt":    DiffMissing,
+		"mode.sh":        DiffModeChanged,
+		"unexpected.txt": DiffUnexpected,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got=%v want=%v", got, want)
+	} else if _, err := gf.Diff(); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("got err=%v want=%v", err, ErrChecksumMismatch)
+	}
+
+	gf.VerifyChecksums = false
+	if diff, err := gf.Diff(); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(diff, plan) {
+		t.Fatalf("got=%s want=%s", diff, plan)
+	}
+	gf.IgnoreUnexpected = true
+	if plan, err := gf.UpdatePlan(); err != nil {
+		t.Fatal(err)
+	} else if len(plan) != 3 {
+		t.Fatalf("got=%d want=%d", len(plan), 3)
+	}
+
+	// Nothing was modified.
+	for name, data := range files {
+		if got, err := ioutil.ReadFile(filepath.Join(c.Dir, name)); err != nil {
+			t.Fatal(err)
+		} else if string(got) != data {
+			t.Fatalf("got=%q want=%q", got, data)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(c.Dir, "missing.txt")); !os.IsNotExist(err) {
+		t.Fatalf("got err=%v want not exist", err)
+	}
+}
+
+func TestGoldenFixturesFailIfUpdated(t *testing.T) {
+	gf := gc.GoldenFixtures()
+	gf.Dir = testDir(t)
+	gf.Flags = "update,fail-if-updated"
+	gf.Add([]byte("a"), "a.txt")
+
+	want := "1 files were updated:\nupdated file: " + filepath.Join(gf.Dir, "a.txt")
+	if err := gf.Test(); err == nil || !strings.HasPrefix(err.Error(), want) {
+		t.Fatalf("got err=%v want=%s", err, want)
+	} else if data, err := ioutil.ReadFile(filepath.Join(gf.Dir, "a.txt")); err != nil {
+		t.Fatal(err)
+	} else if string(data) != "a" {
+		t.Fatalf("got=%q want=%q", data, "a")
+	}
+	if err := gf.Test(); err != nil {
+		t.Fatalf("got err=%v want=nil", err)
+	}
+}
+
+func TestGoldenFixturesTransform(t *testing.T) {
+	c := gc
+	c.Dir = testDir(t)
+	timestamp := regexp.MustCompile(`"time": "[^"]*"`)
+	c.Transform = func(path string, data []byte) []byte {
+		if filepath.Ext(path) != ".json" {
+			return data
+		}
+		return timestamp.ReplaceAll(data, []byte(`"time": "<time>"`))
+	}
+
+	for i, flags := range []string{"update", "", ""} {
+		gf := c.GoldenFixtures()
+		gf.Flags = flags
+		now := time.Now().Add(time.Duration(i) * time.Hour).Format(time.RFC3339)
+		gf.Add([]byte(`{"time": "`+now+`", "value": 1}`), "out.json")
+		if err := gf.Test(); err != nil {
+			t.Fatalf("run %d: %s", i, err)
+		}
+	}
+
+	if data, err := ioutil.ReadFile(filepath.Join(c.Dir, "out.json")); err != nil {
+		t.Fatal(err)
+	} else if want := `{"time": "<time>", "value": 1}`; string(data) != want {
+		t.Fatalf("got=%s want=%s", data, want)
+	}
+}
+
+func TestGoldenFixturesAddReader(t *testing.T) {
+	gf := gc.GoldenFixtures("tmp")
+	if err := gf.AddReader(strings.NewReader("hello"), "ok.txt"); err != nil {
+		t.Fatal(err)
+	}
+	wantErr := errors.New("read error")
+	r := io.MultiReader(strings.NewReader("partial"), errReader{wantErr})
+	if err := gf.AddReader(r, "error.txt"); err != wantErr {
+		t.Fatalf("got err=%v want=%v", err, wantErr)
+	}
+	want := Fixtures{filepath.Join(gc.Dir, "tmp", "ok.txt"): []byte("hello")}
+	if !reflect.DeepEqual(gf.Fixtures, want) {
+		t.Fatalf("got=%#v want=%#v", gf.Fixtures, want)
+	}
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatal("got no panic for duplicate path")
+		}
+	}()
+	gf.AddReader(strings.NewReader("again"), "ok.txt")
+}
+
+// errReader is an io.Reader that always fails with err.
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+func TestFixturesDiffWith(t *testing.T) {
+	output := Fixtures{"changed": []byte("new"), "extra": []byte("extra")}
+	reference := Fixtures{"changed": []byte("old"), "absent": []byte("absent")}
+	tests := []struct {
+		Opts DiffOptions
+		Want map[string]DiffKind
+	}{
+		{
+			Opts: DiffOptions{},
+			Want: map[string]DiffKind{"absent": DiffUnexpected, "changed": DiffChanged, "extra": DiffMissing},
+		},
+		{
+			Opts: DiffOptions{SwapSides: true},
+			Want: map[string]DiffKind{"absent": DiffMissing, "changed": DiffChanged, "extra": DiffUnexpected},
+		},
+	}
+	for _, test := range tests {
+		diff := output.DiffWith(reference, test.Opts)
+		got := map[string]DiffKind{}
+		for _, d := range diff {
+			got[d.Path] = d.Kind
+		}
+		if !reflect.DeepEqual(got, test.Want) {
+			t.Errorf("%+v: got=%v want=%v", test.Opts, got, test.Want)
+		}
+	}
+
+	swapped := output.DiffWith(reference, DiffOptions{SwapSides: true})
+	if want := reference.Diff(output); !reflect.DeepEqual(swapped, want) {
+		t.Errorf("got=%#v want=%#v", swapped, want)
+	}
+}
+
+func TestFixturesDiffRenames(t *testing.T) {
+	got := Fixtures{
+		"new/a.txt": []byte("a"),
+		"b2.txt":    []byte("b"),
+		"b3.txt":    []byte("b"),
+		"empty2":    nil,
+		"changed":   []byte("new"),
+	}
+	want := Fixtures{
+		"old/a.txt": []byte("a"),
+		"b1.txt":    []byte("b"),
+		"empty1":    nil,
+		"changed":   []byte("old"),
+	}
+	diff := got.DiffWith(want, DiffOptions{DetectRenames: true})
+	wantDiff := strings.Join([]string{
+		"renamed file: b1.txt -> b2.txt",
+		"missing file: b3.txt",
+		"changed file: changed",
+		"unexpected file: empty1",
+		"missing file: empty2",
+		"renamed file: old/a.txt -> new/a.txt",
+	}, "\n")
+	if diff.String() != wantDiff {
+		t.Fatalf("got=\n%s\nwant=\n%s", diff, wantDiff)
+	}
+	renamed := diff.ByKind(DiffRenamed)[1]
+	if string(renamed.A) != "a" || string(renamed.B) != "a" || renamed.OldPath != "old/a.txt" {
+		t.Fatalf("got=%+v", renamed)
+	}
+
+	// Without the option, renames are reported as usual.
+	if got := got.Diff(want).Counts(); got[DiffRenamed] != 0 || got[DiffUnexpected] != 3 {
+		t.Fatalf("got=%v", got)
+	}
+}
+
+func TestFixturesMerge(t *testing.T) {
+	f := Fixtures{"a": []byte("a"), "b": []byte("b")}
+	if err := f.Merge(Fixtures{"c": []byte("c")}); err != nil {
+		t.Fatal(err)
+	}
+	want := Fixtures{"a": []byte("a"), "b": []byte("b"), "c": []byte("c")}
+	if !reflect.DeepEqual(f, want) {
+		t.Fatalf("got=%#v want=%#v", f, want)
+	}
+
+	err := f.Merge(Fixtures{"b": []byte("new b"), "d": []byte("d")})
+	if err == nil || err.Error() != "set already has path: b" {
+		t.Fatalf("got err=%v", err)
+	} else if !reflect.DeepEqual(f, want) {
+		t.Fatalf("failed merge modified fixtures: got=%#v want=%#v", f, want)
+	}
+
+	f.MergeOverwrite(Fixtures{"b": []byte("new b"), "d": []byte("d")})
+	want["b"], want["d"] = []byte("new b"), []byte("d")
+	if !reflect.DeepEqual(f, want) {
+		t.Fatalf("got=%#v want=%#v", f, want)
+	}
+}
+
+func TestGoldenFixturesQuiet(t *testing.T) {
+	tmpDir := testDir(t)
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if err := ioutil.WriteFile(filepath.Join(tmpDir, name), []byte(name), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gf := gc.GoldenFixtures()
+	gf.Dir = tmpDir
+	gf.Flags = "quiet,diff"
+	gf.Add([]byte("changed"), "a.txt")
+	gf.Add([]byte("changed"), "b.txt")
+	gf.Add([]byte("missing"), "d.txt")
+
+	want := "4 fixtures differ (2 changed, 1 missing, 1 unexpected)"
+	if err := gf.Test(); err == nil || err.Error() != want {
+		t.Fatalf("got err=%v want=%s", err, want)
+	}
+}
+
+func TestGoldenFixturesUpdateErrors(t *testing.T) {
+	tmpDir := testDir(t)
+	gf := gc.GoldenFixtures()
+	gf.Dir = tmpDir
+	gf.Flags = "update"
+	gf.IgnoreUnexpected = true
+	// Regular files in place of the directories the fixtures need.
+	for _, name := range []string{"z", "b", "m"} {
+		if err := ioutil.WriteFile(filepath.Join(tmpDir, name), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+		gf.Add([]byte("data"), name, "file.txt")
+	}
+
+	var msgs []string
+	for i := 0; i < 5; i++ {
+		err := gf.Test()
+		if err == nil {
+			t.Fatal("got err=nil")
+		}
+		msgs = append(msgs, err.Error())
+		var pathErr *os.PathError
+		if !errors.As(err, &pathErr) {
+			t.Fatalf("got err=%#v want *os.PathError", err)
+		} else if !errors.Is(err, syscall.ENOTDIR) {
+			t.Fatalf("got err=%v want ENOTDIR", err)
+		}
+	}
+	for _, msg := range msgs[1:] {
+		if msg != msgs[0] {
+			t.Fatalf("non-deterministic error:\n%s\n%s", msg, msgs[0])
+		}
+	}
+	lines := strings.Split(msgs[0], "\n")
+	if len(lines) != 4 || lines[0] != "3 errors:" {
+		t.Fatalf("got=%s", msgs[0])
+	}
+	for i, name := range []string{"b", "m", "z"} {
+		if !strings.Contains(lines[i+1], filepath.Join(tmpDir, name)) {
+			t.Errorf("line %d: got=%s want path %s", i+1, lines[i+1], name)
+		}
+	}
+}
+
+func TestGoldenFixturesAllowChanged(t *testing.T) {
+	tmpDir := testDir(t)
+	for _, name := range []string{"flaky.txt", "stable.txt"} {
+		if err := ioutil.WriteFile(filepath.Join(tmpDir, name), []byte(name), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func(w io.Writer) { stderr = w }(stderr)
+	buf := &bytes.Buffer{}
+	stderr = buf
+
+	newGf := func() *GoldenFixtures {
+		gf := gc.GoldenFixtures()
+		gf.Dir = tmpDir
+		gf.Flags = ""
+		gf.AllowChanged("flaky.txt")
+		return gf
+	}
+
+	gf := newGf()
+	gf.Add([]byte("changed"), "flaky.txt")
+	gf.Add([]byte("stable.txt"), "stable.txt")
+	if err := gf.Test(); err != nil {
+		t.Fatalf("got err=%v want=nil", err)
+	} else if !strings.Contains(buf.String(), filepath.Join(tmpDir, "flaky.txt")) {
+		t.Fatalf("missing warning: %q", buf.String())
+	}
+
+	gf = newGf()
+	gf.Add([]byte("changed"), "flaky.txt")
+	gf.Add([]byte("changed"), "stable.txt")
+	if err := gf.Test(); err == nil {
+		t.Fatal("got err=nil")
+	} else if !strings.HasPrefix(err.Error(), "1 errors:\nchanged file: "+filepath.Join(tmpDir, "stable.txt")) {
+		t.Fatalf("got err=%v", err)
+	}
+
+	gf = newGf()
+	gf.Add([]byte("stable.txt"), "stable.txt")
+	if err := gf.Test(); err == nil || !strings.Contains(err.Error(), "unexpected file: ") {
+		t.Fatalf("got err=%v want unexpected file", err)
+	}
+}
+
+func TestFixturesFilter(t *testing.T) {
+	f := Fixtures{"a.txt": []byte("a"), "b.png": []byte("b"), "c.txt": []byte("c")}
+	got := f.Filter(func(path string) bool { return filepath.Ext(path) == ".txt" })
+	want := Fixtures{"a.txt": []byte("a"), "c.txt": []byte("c")}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got=%#v want=%#v", got, want)
+	} else if len(f) != 3 {
+		t.Fatal("Filter modified the original")
+	}
+}
+
+func TestEnvConfigDir(t *testing.T) {
+	defer os.Setenv("GOLDY_DIR", os.Getenv("GOLDY_DIR"))
+	tests := []struct {
+		Env     string
+		Dir     string
+		WantDir string
+	}{
+		{WantDir: "test-fixtures"},
+		{Env: "/mnt/fixtures", WantDir: "/mnt/fixtures"},
+		{Env: "/mnt/fixtures", Dir: "explicit", WantDir: "explicit"},
+	}
+	for i, test := range tests {
+		os.Setenv("GOLDY_DIR", test.Env)
+		c := EnvConfig("GOLDY")
+		if test.Dir != "" {
+			c = c.WithDir(test.Dir)
+		}
+		if c.Dir != test.WantDir {
+			t.Errorf("%d: got=%q want=%q", i, c.Dir, test.WantDir)
+		} else if gf := c.GoldenFixtures("out"); gf.Dir != filepath.Join(test.WantDir, "out") {
+			t.Errorf("%d: got=%q want=%q", i, gf.Dir, filepath.Join(test.WantDir, "out"))
+		}
+	}
+}
+
+func TestGoldenFixturesOnly(t *testing.T) {
+	defer os.Setenv("GOLDY_ONLY", os.Getenv("GOLDY_ONLY"))
+	os.Setenv("GOLDY_ONLY", "sub/*.txt")
+	c := EnvConfig("GOLDY")
+	if c.Only != "sub/*.txt" {
+		t.Fatalf("got only=%q want=%q", c.Only, "sub/*.txt")
+	}
+
+	c.Dir = testDir(t)
+	c.Flags = ""
+	files := []string{"a.txt", filepath.Join("sub", "b.txt"), filepath.Join("sub", "c.txt")}
+	for _, name := range files {
+		path := filepath.Join(c.Dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		} else if err := ioutil.WriteFile(path, []byte(name), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gf := c.GoldenFixtures()
+	gf.Add([]byte(files[1]), files[1])
+	gf.Add([]byte("changed"), "a.txt")
+	if err := gf.Test(); err == nil {
+		t.Fatal("got err=nil")
+	} else if want := "1 errors:\nunexpected file: " + filepath.Join(c.Dir, files[2]); !strings.HasPrefix(err.Error(), want) {
+		t.Fatalf("got err=%s want=%s", err, want)
+	}
+
+	gf.Only = "["
+	if err := gf.Test(); err == nil || !strings.Contains(err.Error(), "bad only pattern") {
+		t.Fatalf("got err=%v want bad pattern", err)
+	}
+}
+
+// fakeRunner records the result of every subtest run via Run.
+type fakeRunner struct {
+	fakeTB
+	results map[string]string
+}
+
+func (r *fakeRunner) Run(name string, fn func(t testing.TB)) bool {
+	sub := &fakeTB{}
+	fn(sub)
+	r.results[name] = sub.fatal
+	return sub.fatal == ""
+}
+
+func TestGoldenFixturesRunSubtests(t *testing.T) {
+	tmpDir := testDir(t)
+	for name, data := range map[string]string{"same.txt": "same", "changed.txt": "old", "extra.txt": "extra"} {
+		if err := ioutil.WriteFile(filepath.Join(tmpDir, name), []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	newGf := func(flags string) *GoldenFixtures {
+		gf := gc.GoldenFixtures()
+		gf.Dir = tmpDir
+		gf.Flags = flags
+		gf.Add([]byte("same"), "same.txt")
+		gf.Add([]byte("new"), "changed.txt")
+		gf.Add([]byte("missing"), "sub", "missing.txt")
+		return gf
+	}
+
+	r := &fakeRunner{results: map[string]string{}}
+	newGf("").runSubtests(r)
+	if got, want := len(r.results), 4; got != want {
+		t.Fatalf("got=%d want=%d: %v", got, want, r.results)
+	}
+	for name, want := range map[string]string{
+		"same.txt":        "",
+		"changed.txt":     "changed file: ",
+		"extra.txt":       "unexpected file: ",
+		"sub/missing.txt": "missing file: ",
+	} {
+		got := r.results[name]
+		if want == "" && got != "" || !strings.Contains(got, want) {
+			t.Errorf("%s: got=%q want=%q", name, got, want)
+		}
+	}
+
+	r = &fakeRunner{results: map[string]string{}}
+	newGf("update").runSubtests(r)
+	for name, got := range r.results {
+		if got != "" {
+			t.Errorf("%s: got=%q want none", name, got)
+		}
+	}
+	r = &fakeRunner{results: map[string]string{}}
+	newGf("").runSubtests(r)
+	if got, want := len(r.results), 3; got != want {
+		t.Fatalf("got=%d want=%d: %v", got, want, r.results)
+	}
+	for name, got := range r.results {
+		if got != "" {
+			t.Errorf("%s: got=%q want none", name, got)
+		}
+	}
+}
+
+func TestGoldenFixturesRunSubtestsOnce(t *testing.T) {
+	defer func(w io.Writer) { stdout = w }(stdout)
+	buf := &bytes.Buffer{}
+	stdout = buf
+	c := TempConfig(t)
+	var calls [][]string
+	c.OnUpdate = func(written []string) error {
+		calls = append(calls, written)
+		return nil
+	}
+	newGf := func(flags string) *GoldenFixtures {
+		gf := c.GoldenFixtures()
+		gf.Flags = flags
+		for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+			gf.Add([]byte(flags), name)
+		}
+		return gf
+	}
+
+	// FlagJSON prints a single diff for all subtests.
+	r := &fakeRunner{results: map[string]string{}}
+	newGf(string(FlagJSON)).runSubtests(r)
+	if got := strings.Count(buf.String(), "\n"); got != 1 {
+		t.Errorf("got=%d want=%d: %q", got, 1, buf.String())
+	} else if got := strings.Count(buf.String(), `"kind":"missing"`); got != 3 {
+		t.Errorf("got=%d want=%d: %q", got, 3, buf.String())
+	}
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if got := r.results[name]; !strings.Contains(got, "missing file: "+filepath.Join(c.Dir, name)) {
+			t.Errorf("%s: got=%q want missing file", name, got)
+		}
+	}
+
+	// Updates happen at once, and FlagFailIfUpdated fails every subtest
+	// whose file was updated.
+	r = &fakeRunner{results: map[string]string{}}
+	newGf("update,fail-if-updated").runSubtests(r)
+	want := [][]string{{filepath.Join(c.Dir, "a.txt"), filepath.Join(c.Dir, "b.txt"), filepath.Join(c.Dir, "c.txt")}}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("got=%v want=%v", calls, want)
+	}
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if got, want := r.results[name], "1 files were updated:\nupdated file: "+filepath.Join(c.Dir, name); !strings.HasPrefix(got, want) {
+			t.Errorf("%s: got=%q want=%q", name, got, want)
+		}
+	}
+}
+func TestGoldenFixturesFileMode(t *testing.T) {
+	tmpDir := testDir(t)
+	tests := []struct {
+		FileMode     os.FileMode
+		DirMode      os.FileMode
+		WantFileMode os.FileMode
+		WantDirMode  os.FileMode
+	}{
+		{WantFileMode: 0600, WantDirMode: 0700},
+		{FileMode: 0640, DirMode: 0750, WantFileMode: 0640, WantDirMode: 0750},
+	}
+	for i, test := range tests {
+		c := (Config{Dir: tmpDir, Flags: "update", FileMode: test.FileMode, DirMode: test.DirMode}).WithDefaults()
+		gf := c.GoldenFixtures(fmt.Sprint(i))
+		gf.Add([]byte("hello"), "sub", "a.txt")
+		if err := gf.Test(); err != nil {
+			t.Fatal(err)
+		}
+		if info, err := os.Stat(filepath.Join(tmpDir, fmt.Sprint(i), "sub", "a.txt")); err != nil {
+			t.Fatal(err)
+		} else if got := info.Mode().Perm(); got != test.WantFileMode {
+			t.Errorf("%d: got file mode=%o want=%o", i, got, test.WantFileMode)
+		}
+		if info, err := os.Stat(filepath.Join(tmpDir, fmt.Sprint(i), "sub")); err != nil {
+			t.Fatal(err)
+		} else if got := info.Mode().Perm(); got != test.WantDirMode {
+			t.Errorf("%d: got dir mode=%o want=%o", i, got, test.WantDirMode)
+		}
+	}
+}
+
+func TestGoldenFixturesAutoDiffLimit(t *testing.T) {
+	tmpDir := testDir(t)
+	golden := []byte("old\n")
+	if err := ioutil.WriteFile(filepath.Join(tmpDir, "a.txt"), golden, 0600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		Flags    string
+		Limit    int
+		Data     string
+		WantDiff bool
+	}{
+		{Limit: 8, Data: "new data", WantDiff: true},
+		{Limit: 8, Data: "new data!", WantDiff: false},
+		{Limit: 8, Data: "new data!", Flags: "diff", WantDiff: true},
+		{Limit: 0, Data: "new", WantDiff: false},
+		{Limit: 8, Data: "new\x00", WantDiff: false},
+	}
+	for i, test := range tests {
+		gf := gc.GoldenFixtures()
+		gf.Dir = tmpDir
+		gf.Flags = test.Flags
+		gf.AutoDiffLimit = test.Limit
+		gf.Add([]byte(test.Data), "a.txt")
+		err := gf.Test()
+		if err == nil {
+			t.Fatalf("%d: got err=nil", i)
+		} else if got := strings.Contains(err.Error(), "-old"); got != test.WantDiff {
+			t.Errorf("%d: got diff=%v want=%v: %s", i, got, test.WantDiff, err)
+		}
+	}
+}
+
+func TestFixturesAddClean(t *testing.T) {
+	catch := func(fn func()) (msg string) {
+		defer func() { msg = fmt.Sprint(recover()) }()
+		fn()
+		return
+	}
+	tests := []struct {
+		First  []string
+		Second []string
+		Want   string
+	}{
+		{[]string{"a", "b"}, []string{"a/b"}, `set already has path: a/b (added as ["a/b"])`},
+		{[]string{"a/b"}, []string{"./a", "b"}, `set already has path: a/b (added as ["./a" "b"])`},
+		{[]string{"a", "b"}, []string{"a//c/../b/"}, `set already has path: a/b (added as ["a//c/../b/"])`},
+	}
+	for i, test := range tests {
+		f := Fixtures{}
+		f.Add(nil, test.First...)
+		if got := catch(func() { f.Add(nil, test.Second...) }); got != filepath.FromSlash(test.Want) {
+			t.Errorf("%d: got=%q want=%q", i, got, test.Want)
+		}
+	}
+
+	gf := &GoldenFixtures{Dir: "dir", Fixtures: Fixtures{}}
+	gf.Add(nil, "a", "b")
+	want := filepath.FromSlash(`set already has path: dir/a/b (added as ["a" "b"] and ["a/b"])`)
+	if got := catch(func() { gf.Add(nil, "a/b") }); got != want {
+		t.Errorf("got=%q want=%q", got, want)
+	}
+}
+
+func TestFixturesSet(t *testing.T) {
+	f := Fixtures{}
+	f.Set([]byte("a"), "a", "b")
+	f.Set([]byte("b"), "./a/b")
+	if len(f) != 1 {
+		t.Fatalf("got=%d want=%d", len(f), 1)
+	} else if data, ok := f.Get("a/b"); !ok || string(data) != "b" {
+		t.Fatalf("got=%q %v want=%q true", data, ok, "b")
+	}
+
+	defer func() {
+		want := `set already has path: a/b (added as ["a" "b"])`
+		if got := fmt.Sprint(recover()); got != filepath.FromSlash(want) {
+			t.Fatalf("got=%q want=%q", got, want)
+		}
+	}()
+	f.Add([]byte("c"), "a", "b")
+}
+
+func TestFixturesEqual(t *testing.T) {
+	a := Fixtures{"a": []byte("a"), "b": []byte("b")}
+	tests := []struct {
+		B    Fixtures
+		Want bool
+	}{
+		{Fixtures{"a": []byte("a"), "b": []byte("b")}, true},
+		{Fixtures{"a": []byte("a"), "b": []byte("b"), "c": []byte("c")}, false},
+		{Fixtures{"a": []byte("a")}, false},
+		{Fixtures{"a": []byte("a"), "c": []byte("b")}, false},
+		{Fixtures{"a": []byte("a"), "b": []byte("changed")}, false},
+	}
+	for i, test := range tests {
+		if got := a.Equal(test.B); got != test.Want {
+			t.Errorf("%d: got=%v want=%v", i, got, test.Want)
+		} else if got := test.B.Equal(a); got != test.Want {
+			t.Errorf("%d: got=%v want=%v (swapped)", i, got, test.Want)
+		}
+	}
+}
+
+func TestGoldenFixturesOnMismatch(t *testing.T) {
+	tmpDir := testDir(t)
+	if err := ioutil.WriteFile(filepath.Join(tmpDir, "a.txt"), []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		Flags string
+		Data  string
+		Want  Diff
+	}{
+		{Data: "old"},
+		{Data: "new", Want: Diff{{Path: filepath.Join(tmpDir, "a.txt"), Kind: DiffChanged, A: []byte("old"), B: []byte("new")}}},
+		{Data: "new", Flags: "quiet", Want: Diff{{Path: filepath.Join(tmpDir, "a.txt"), Kind: DiffChanged, A: []byte("old"), B: []byte("new")}}},
+		{Data: "newer", Flags: "update"},
+	}
+	for i, test := range tests {
+		var got Diff
+		gf := (Config{Dir: tmpDir, Flags: test.Flags, OnMismatch: func(diff Diff) {
+			got = append(got, diff...)
+		}}).WithDefaults().GoldenFixtures()
+		gf.Add([]byte(test.Data), "a.txt")
+		gf.Test()
+		if !reflect.DeepEqual(got, test.Want) {
+			t.Errorf("%d: got=%v want=%v", i, got, test.Want)
+		}
+	}
+}
+
+func TestGoldenFixturesRewrite(t *testing.T) {
+	tmpDir := testDir(t)
+	for _, name := range []string{"keep.txt", ".hidden", "stale/nested/orphan.txt"} {
+		path := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		} else if err := ioutil.WriteFile(path, []byte("old"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gf := gc.GoldenFixtures()
+	gf.Dir = tmpDir
+	gf.Flags = "rewrite"
+	gf.IgnoreUnexpected = true
+	gf.Add([]byte("new"), "keep.txt")
+	gf.Add([]byte("new"), "sub", "new.txt")
+	if err := gf.Test(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Load(tmpDir, func(string) bool { return false })
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Fixtures{
+		filepath.Join(tmpDir, ".hidden"):        []byte("old"),
+		filepath.Join(tmpDir, "keep.txt"):       []byte("new"),
+		filepath.Join(tmpDir, "sub", "new.txt"): []byte("new"),
+	}
+	if !got.Equal(want) {
+		t.Errorf("got=%v want=%v", got.Paths(), want.Paths())
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "stale")); !os.IsNotExist(err) {
+		t.Errorf("got err=%v want not exist", err)
+	}
+
+	for _, dir := range []string{"", ".", string(filepath.Separator)} {
+		gf := gc.GoldenFixtures()
+		gf.Dir = dir
+		gf.Flags = "rewrite"
+		if err := gf.Test(); err == nil || !strings.Contains(err.Error(), "refusing to rewrite dir") {
+			t.Errorf("%q: got err=%v want refusal", dir, err)
+		}
+	}
+}
+
+func TestGoldenFixturesRewriteFlags(t *testing.T) {
+	c := TempConfig(t)
+	oldPath, newPath := filepath.Join(c.Dir, "old.txt"), filepath.Join(c.Dir, "new.txt")
+	if err := ioutil.WriteFile(oldPath, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	newGf := func(flags string) *GoldenFixtures {
+		gf := c.GoldenFixtures()
+		gf.Flags = flags
+		gf.Add([]byte("new"), "new.txt")
+		return gf
+	}
+
+	// FlagDryRun only reports the planned operations.
+	want := "dry-run: 2 planned operations:\ncreate: " + newPath + "\ndelete: " + oldPath
+	if err := newGf("rewrite,dry-run").Test(); err == nil || err.Error() != want {
+		t.Fatalf("got err=%v want=%v", err, want)
+	} else if _, err := os.Stat(oldPath); err != nil {
+		t.Fatal(err)
+	} else if _, err := os.Stat(newPath); !os.IsNotExist(err) {
+		t.Fatalf("got err=%v want not exist", err)
+	}
+
+	// FlagFailIfUpdated fails after rewriting, but only if anything changed.
+	want = "2 files were updated:\nupdated file: " + newPath + "\nupdated file: " + oldPath + "\n\ncommit the updated files above"
+	if err := newGf("rewrite,fail-if-updated").Test(); err == nil || err.Error() != want {
+		t.Fatalf("got err=%v want=%v", err, want)
+	} else if _, err := os.Stat(oldPath); !os.IsNotExist(err) {
+		t.Fatalf("got err=%v want not exist", err)
+	} else if data, err := ioutil.ReadFile(newPath); err != nil {
+		t.Fatal(err)
+	} else if string(data) != "new" {
+		t.Fatalf("got=%q want=%q", data, "new")
+	}
+	if r, err := newGf("rewrite,fail-if-updated").TestResult(); err != nil {
+		t.Fatal(err)
+	} else if r.Updated || len(r.Diff) > 0 {
+		t.Fatalf("got updated=%v diff=%v want none", r.Updated, r.Diff)
+	}
+}
+
+func TestGoldenFixturesRewriteOptions(t *testing.T) {
+	// Neither Reference nor VerifyChecksums may keep a rewrite from writing
+	// the golden fixtures it just removed.
+	for _, name := range []string{"reference", "checksums"} {
+		t.Run(name, func(t *testing.T) {
+			c := TempConfig(t)
+			newGf := func(flags string) *GoldenFixtures {
+				gf := c.GoldenFixtures("out")
+				gf.Flags = flags
+				if name == "reference" {
+					gf.Reference = func(path string) ([]byte, error) { return []byte("a"), nil }
+				} else {
+					gf.VerifyChecksums = true
+				}
+				gf.Add([]byte("a"), "a.txt")
+				return gf
+			}
+			if err := newGf(string(FlagUpdate)).Test(); err != nil {
+				t.Fatal(err)
+			} else if err := newGf(string(FlagRewrite)).Test(); err != nil {
+				t.Fatal(err)
+			} else if data, err := ioutil.ReadFile(filepath.Join(c.Dir, "out", "a.txt")); err != nil {
+				t.Fatal(err)
+			} else if string(data) != "a" {
+				t.Fatalf("got=%q want=%q", data, "a")
+			} else if err := newGf("").Test(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+func TestFixturesHashes(t *testing.T) {
+	f := Fixtures{}
+	f.Add([]byte("hello"), "b", "hello.txt")
+	f.Add([]byte(""), "a.txt")
+	want := map[string]string{
+		filepath.Join("b", "hello.txt"): "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+		"a.txt":                         "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+	}
+	if got := f.Hashes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v want=%v", got, want)
+	}
+
+	wantManifest := "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855  a.txt\n" +
+		"2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824  b/hello.txt\n"
+	for i := 0; i < 10; i++ {
+		if got := string(HashManifest(f)); got != wantManifest {
+			t.Fatalf("got=%q want=%q", got, wantManifest)
+		}
+	}
+	if got := string(HashManifest(Fixtures{})); got != "" {
+		t.Errorf("got=%q want empty", got)
+	}
+}
+
+func TestGoldenFixturesStats(t *testing.T) {
+	tmpDir := testDir(t)
+	if err := ioutil.WriteFile(filepath.Join(tmpDir, "a.txt"), []byte("hello"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer func(w io.Writer) { stderr = w }(stderr)
+	buf := &bytes.Buffer{}
+	stderr = buf
+
+	gf := gc.GoldenFixtures()
+	gf.Dir = tmpDir
+	gf.Flags = "stats"
+	gf.Add([]byte("hello"), "a.txt")
+	gf.Add([]byte("new"), "b.txt")
+	if err := gf.Test(); err == nil {
+		t.Fatal("got err=nil")
+	}
+
+	var (
+		dir              string
+		fixtures         int
+		size             int64
+		load, compareDur string
+	)
+	line := strings.Replace(buf.String(), "=", " ", -1)
+	if _, err := fmt.Sscanf(line, "goldy: stats: dir %s fixtures %d bytes %d load %s compare %s\n", &dir, &fixtures, &size, &load, &compareDur); err != nil {
+		t.Fatalf("could not parse %q: %s", buf.String(), err)
+	} else if dir != tmpDir || fixtures != 2 || size != 13 {
+		t.Errorf("got dir=%s fixtures=%d bytes=%d want dir=%s fixtures=2 bytes=13", dir, fixtures, size, tmpDir)
+	}
+	for _, d := range []string{load, compareDur} {
+		if _, err := time.ParseDuration(d); err != nil {
+			t.Errorf("bad duration: %s", err)
+		}
+	}
+}
+
+func TestFixturesSub(t *testing.T) {
+	f := Fixtures{}
+	for _, path := range []string{"a/b.txt", "a/c/d.txt", "ab/e.txt", "a.txt", "f.txt"} {
+		f.Add([]byte(path), path)
+	}
+	tests := []struct {
+		Prefix string
+		Want   []string
+	}{
+		{"a", []string{"b.txt", filepath.Join("c", "d.txt")}},
+		{"a/", []string{"b.txt", filepath.Join("c", "d.txt")}},
+		{"./a/c", []string{"d.txt"}},
+		{"ab", []string{"e.txt"}},
+		{"a.txt", nil},
+		{"missing", nil},
+		{".", f.Paths()},
+	}
+	for _, test := range tests {
+		got := f.Sub(filepath.FromSlash(test.Prefix))
+		if paths := got.Paths(); !reflect.DeepEqual(paths, test.Want) && len(paths)+len(test.Want) > 0 {
+			t.Errorf("%q: got=%v want=%v", test.Prefix, paths, test.Want)
+		}
+	}
+	if got := string(f.Sub("a")[filepath.Join("c", "d.txt")]); got != "a/c/d.txt" {
+		t.Errorf("got=%q want=%q", got, "a/c/d.txt")
+	}
+}
+
+func TestGoldenFixturesLogf(t *testing.T) {
+	tmpDir := testDir(t)
+	for _, name := range []string{"changed.txt", "unexpected.txt", ".hidden"} {
+		if err := ioutil.WriteFile(filepath.Join(tmpDir, name), []byte("old"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var log []string
+	c := gc.WithDir(tmpDir).WithFlags("update")
+	c.Logf = func(format string, args ...interface{}) {
+		log = append(log, fmt.Sprintf(format, args...))
+	}
+	gf := c.GoldenFixtures()
+	gf.Add([]byte("new"), "changed.txt")
+	gf.Add([]byte("new"), "missing.txt")
+	if err := gf.Test(); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(log)
+	want := []string{
+		"goldy: diff: added: " + filepath.Join(tmpDir, "unexpected.txt"),
+		"goldy: diff: changed: " + filepath.Join(tmpDir, "changed.txt"),
+		"goldy: diff: missing: " + filepath.Join(tmpDir, "missing.txt"),
+		"goldy: excluded: " + filepath.Join(tmpDir, ".hidden"),
+		"goldy: loaded: " + filepath.Join(tmpDir, "changed.txt"),
+		"goldy: loaded: " + filepath.Join(tmpDir, "unexpected.txt"),
+		"goldy: removed: " + filepath.Join(tmpDir, "unexpected.txt"),
+		"goldy: wrote: " + filepath.Join(tmpDir, "changed.txt"),
+		"goldy: wrote: " + filepath.Join(tmpDir, "missing.txt"),
+	}
+	if !reflect.DeepEqual(log, want) {
+		t.Errorf("got=%q\nwant=%q", log, want)
+	}
+}
+
+func TestFixturesWriteDir(t *testing.T) {
+	tmpDir := testDir(t)
+	f := Fixtures{}
+	f.Add([]byte("a"), "a.txt")
+	f.Add([]byte("b"), "sub", "b.txt")
+	f.Add([]byte("c"), "sub", "nested", "c.txt")
+	if err := f.WriteDir(tmpDir, 0640); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Load(tmpDir, func(string) bool { return false })
+	if err != nil {
+		t.Fatal(err)
+	} else if want := f.Sub("."); !got.Sub(tmpDir).Equal(want) {
+		t.Fatalf("got=%v want=%v", got.Sub(tmpDir).Paths(), want.Paths())
+	}
+	if info, err := os.Stat(filepath.Join(tmpDir, "sub", "nested", "c.txt")); err != nil {
+		t.Fatal(err)
+	} else if info.Mode().Perm() != 0640 {
+		t.Errorf("got mode=%o want=640", info.Mode().Perm())
+	}
+
+	// Overwriting replaces the files.
+	f[filepath.Join("sub", "b.txt")] = []byte("changed")
+	if err := f.WriteDir(tmpDir, 0600); err != nil {
+		t.Fatal(err)
+	} else if data, err := ioutil.ReadFile(filepath.Join(tmpDir, "sub", "b.txt")); err != nil || string(data) != "changed" {
+		t.Fatalf("got data=%q err=%v want=changed", data, err)
+	}
+
+	// Paths outside of dir are rejected without writing anything.
+	f = Fixtures{"d.txt": []byte("d"), "../x.txt": []byte("x")}
+	if err := f.WriteDir(tmpDir, 0600); err == nil || err.Error() != "path outside of root: ../x.txt" {
+		t.Fatalf("got err=%v want path outside of root", err)
+	} else if _, err := os.Stat(filepath.Join(tmpDir, "d.txt")); !os.IsNotExist(err) {
+		t.Fatalf("got err=%v want not exist", err)
+	} else if _, err := os.Stat(filepath.Join(filepath.Dir(tmpDir), "x.txt")); !os.IsNotExist(err) {
+		t.Fatalf("got err=%v want not exist", err)
+	}
+}
+
+func TestFixtureKeys(t *testing.T) {
+	tests := []struct {
+		Path []string
+		Want string
+	}{
+		{[]string{"a", "b", "c.txt"}, "a/b/c.txt"},
+		{[]string{filepath.Join("a", "b"), "c.txt"}, "a/b/c.txt"},
+		{[]string{filepath.FromSlash("./a/../a/b/"), "c.txt"}, "a/b/c.txt"},
+		{[]string{"a/b/c.txt"}, "a/b/c.txt"},
+	}
+	for i, test := range tests {
+		f := Fixtures{}
+		f.Add(nil, test.Path...)
+		if got := f.Paths(); len(got) != 1 || got[0] != test.Want {
+			t.Errorf("%d: got=%v want=%v", i, got, test.Want)
+		}
+	}
+
+	dir := filepath.Join(gc.Dir, "in", "nested")
+	loaded, err := Load(dir, IsDotfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path := range loaded {
+		if path != filepath.ToSlash(path) || !strings.HasPrefix(path, filepath.ToSlash(dir)+"/") {
+			t.Errorf("got key=%q want forward slashes", path)
+		}
+	}
+
+	// Round-tripping through disk keeps the keys.
+	tmpDir := testDir(t)
+	want := Fixtures{"a/b/c.txt": []byte("c"), "d.txt": []byte("d")}
+	if err := want.WriteDir(tmpDir, 0600); err != nil {
+		t.Fatal(err)
+	} else if got, err := Load(tmpDir, IsDotfile); err != nil {
+		t.Fatal(err)
+	} else if got = got.Sub(tmpDir); !got.Equal(want) {
+		t.Errorf("got=%v want=%v", got.Paths(), want.Paths())
+	}
+}
+
+func TestGoldenFixturesMaxDiffLines(t *testing.T) {
+	tmpDir := testDir(t)
+	if err := ioutil.WriteFile(filepath.Join(tmpDir, "a.txt"), []byte("1\n2\n3\n4"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// The full diff has 9 lines: the hunk header, 4 removed and 4 added lines.
+	full := "  @@ -1,4 +1,4 @@\n  -1\n  -2\n  -3\n  -4\n  +a\n  +b\n  +c\n  +d"
+	tests := []struct {
+		Max  int
+		Want string
+	}{
+		{Max: 0, Want: full},
+		{Max: 9, Want: full},
+		{Max: 3, Want: "  @@ -1,4 +1,4 @@\n  -1\n  -2\n  ... (6 more lines)"},
+		{Max: 1, Want: "  @@ -1,4 +1,4 @@\n  ... (8 more lines)"},
+	}
+	for _, test := range tests {
+		gf := gc.GoldenFixtures()
+		gf.Dir = tmpDir
+		gf.Flags = "diff"
+		gf.MaxDiffLines = test.Max
+		gf.Add([]byte("a\nb\nc\nd"), "a.txt")
+		want := "changed file: " + filepath.Join(tmpDir, "a.txt") + "\n" + test.Want + "\n\n"
+		if err := gf.Test(); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%d: got err=%v want=%s", test.Max, err, want)
+		}
+	}
+}
+
+func TestFixturesDiffInto(t *testing.T) {
+	tests := []struct {
+		A, B Fixtures
+	}{
+		{Fixtures{}, Fixtures{}},
+		{Fixtures{"a": []byte("a")}, Fixtures{"a": []byte("a")}},
+		{Fixtures{"a": []byte("a"), "b": []byte("b")}, Fixtures{"a": []byte("x"), "c": []byte("c")}},
+		{Fixtures{"b": []byte("b")}, Fixtures{}},
+		{Fixtures{}, Fixtures{"a": []byte("a"), "b": []byte("b"), "c": []byte("c")}},
+	}
+	var dst Diff
+	for i, test := range tests {
+		want := test.A.Diff(test.B)
+		dst = test.A.DiffInto(test.B, dst)
+		if len(dst) != len(want) {
+			t.Fatalf("%d: got=%v want=%v", i, dst, want)
+		}
+		for j := range want {
+			if !reflect.DeepEqual(dst[j], want[j]) {
+				t.Errorf("%d: got=%+v want=%+v", i, dst[j], want[j])
+			}
+		}
+	}
+}
+
+func BenchmarkFixturesDiff(b *testing.B) {
+	a, other := Fixtures{}, Fixtures{}
+	for i := 0; i < 100; i++ {
+		path := fmt.Sprintf("%03d.txt", i)
+		a[path] = []byte(path)
+		if i%2 == 0 {
+			other[path] = []byte("changed")
+		}
+	}
+	b.Run("Diff", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			a.Diff(other)
+		}
+	})
+	b.Run("DiffInto", func(b *testing.B) {
+		b.ReportAllocs()
+		var diff Diff
+		for i := 0; i < b.N; i++ {
+			diff = a.DiffInto(other, diff)
+		}
+	})
+}
+
+func TestFixturesDiffUnexpectedData(t *testing.T) {
+	a := Fixtures{"a.txt": []byte("a")}
+	b := Fixtures{"a.txt": []byte("a"), "b.txt": []byte("stray")}
+	for _, test := range []struct {
+		Name string
+		Diff Diff
+	}{
+		{"Diff", a.Diff(b)},
+		{"SwapSides", b.DiffWith(a, DiffOptions{SwapSides: true})},
+	} {
+		if len(test.Diff) != 1 {
+			t.Fatalf("%s: got=%d want=%d", test.Name, len(test.Diff), 1)
+		} else if d := test.Diff[0]; d.Kind != DiffUnexpected || string(d.A) != "stray" || d.B != nil {
+			t.Errorf("%s: got=%s %q %q want=%s %q %q", test.Name, d.Kind, d.A, d.B, DiffUnexpected, "stray", "")
+		}
+	}
+}
+
+func TestDiffByKind(t *testing.T) {
+	diff := Diff{
+		{Path: "a.txt", Kind: DiffUnexpected},
+		{Path: "b.txt", Kind: DiffMissing},
+		{Path: "c.txt", Kind: DiffChanged},
+		{Path: "d.txt", Kind: DiffMissing},
+		{Path: "e.txt", Kind: DiffModeChanged},
+	}
+	tests := []struct {
+		Kind DiffKind
+		Want []string
+	}{
+		{Kind: DiffUnexpected, Want: []string{"a.txt"}},
+		{Kind: DiffMissing, Want: []string{"b.txt", "d.txt"}},
+		{Kind: DiffChanged, Want: []string{"c.txt"}},
+		{Kind: DiffModeChanged, Want: []string{"e.txt"}},
+		{Kind: DiffKind("other"), Want: nil},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, d := range diff.ByKind(test.Kind) {
+			got = append(got, d.Path)
+		}
+		if !reflect.DeepEqual(got, test.Want) {
+			t.Errorf("%s: got=%v want=%v", test.Kind, got, test.Want)
+		}
+	}
+
+	want := map[DiffKind]int{DiffUnexpected: 1, DiffMissing: 2, DiffChanged: 1, DiffModeChanged: 1}
+	if got := diff.Counts(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v want=%v", got, want)
+	} else if got := (Diff{}).Counts(); len(got) != 0 {
+		t.Errorf("got=%v want=%v", got, map[DiffKind]int{})
+	}
+}
+
+func TestDiffString(t *testing.T) {
+	tests := []struct {
+		Diff        Diff
+		Want        string
+		WantChanges bool
+	}{
+		{Diff: nil, Want: ""},
+		{Diff: Diff{}, Want: ""},
+		{
+			Diff: Diff{
+				{Path: "d.txt", Kind: DiffModeChanged, ModeA: 0600, ModeB: 0755},
+				{Path: "c.txt", Kind: DiffChanged, A: []byte("old"), B: []byte("new")},
+				{Path: "b.txt", Kind: DiffMissing, B: []byte("b")},
+				{Path: "a.txt", Kind: DiffUnexpected},
+			},
+			Want: "unexpected file: a.txt\n" +
+				"missing file: b.txt\n" +
+				"changed file: c.txt\n" +
+				"mode changed: d.txt (0600 -> 0755)",
+			WantChanges: true,
+		},
+		{
+			Diff:        Diff{{Path: "a.bin", Kind: DiffChanged, A: []byte("a\x00"), B: []byte("b\x00c")}},
+			Want:        "changed file: a.bin (2 -> 3 bytes, 2 bytes differ)",
+			WantChanges: true,
+		},
+		{
+			Diff:        Diff{{Path: "a.png", Kind: DiffChanged, Detail: "3 pixels differ, max delta 9"}},
+			Want:        "changed file: a.png (3 pixels differ, max delta 9)",
+			WantChanges: true,
+		},
+	}
+	for i, test := range tests {
+		if got := test.Diff.String(); got != test.Want {
+			t.Errorf("%d: got=%q want=%q", i, got, test.Want)
+		} else if got := test.Diff.HasChanges(); got != test.WantChanges {
+			t.Errorf("%d: got=%v want=%v", i, got, test.WantChanges)
+		}
+	}
+}
+
+func TestGoldenFixturesAutoCreate(t *testing.T) {
+	tmpDir := filepath.Join(testDir(t), "golden")
+	defer func(w io.Writer) { stderr = w }(stderr)
+	buf := &bytes.Buffer{}
+	stderr = buf
+
+	newGf := func(data string) *GoldenFixtures {
+		gf := gc.GoldenFixtures()
+		gf.Dir = tmpDir
+		gf.Flags = ""
+		gf.AutoCreate = true
+		gf.Add([]byte(data), "a.txt")
+		return gf
+	}
+	if r, err := newGf("a").TestResult(); err != nil {
+		t.Fatalf("got err=%v want=nil", err)
+	} else if !r.Updated || r.Counts[DiffMissing] != 1 {
+		t.Fatalf("got result=%+v want one created file", r)
+	} else if !strings.Contains(buf.String(), "goldy: creating missing golden fixtures: "+tmpDir) {
+		t.Fatalf("missing log: %q", buf.String())
+	} else if data, err := ioutil.ReadFile(filepath.Join(tmpDir, "a.txt")); err != nil || string(data) != "a" {
+		t.Fatalf("got data=%q err=%v", data, err)
+	}
+
+	// Once the dir exists, mismatches fail again.
+	buf.Reset()
+	if err := newGf("changed").Test(); err == nil || !strings.Contains(err.Error(), "changed file: ") {
+		t.Fatalf("got err=%v want changed file", err)
+	} else if buf.Len() > 0 {
+		t.Fatalf("unexpected log: %q", buf.String())
+	}
+	gf := newGf("a")
+	gf.Add([]byte("b"), "b.txt")
+	if err := gf.Test(); err == nil || !strings.Contains(err.Error(), "missing file: ") {
+		t.Fatalf("got err=%v want missing file", err)
+	}
+}
+
+func TestFixturesGet(t *testing.T) {
+	f := Fixtures{}
+	f.Add([]byte("c"), "a", "b", "c.txt")
+	f.Add([]byte("d"), "d.txt")
+	tests := []struct {
+		Path   []string
+		Want   string
+		WantOK bool
+	}{
+		{[]string{"a", "b", "c.txt"}, "c", true},
+		{[]string{"a/b/c.txt"}, "c", true},
+		{[]string{filepath.Join("a", "b"), "c.txt"}, "c", true},
+		{[]string{"./a/x/../b/c.txt"}, "c", true},
+		{[]string{"d.txt"}, "d", true},
+		{[]string{"a", "b"}, "", false},
+		{[]string{"missing.txt"}, "", false},
+	}
+	for i, test := range tests {
+		data, ok := f.Get(test.Path...)
+		if string(data) != test.Want || ok != test.WantOK {
+			t.Errorf("%d: got=%q %v want=%q %v", i, data, ok, test.Want, test.WantOK)
+		}
+	}
+}
+
+func TestFixturesSizes(t *testing.T) {
+	f, err := gc.InputFixtures("in", "nested")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f = f.Sub(filepath.Join(gc.Dir, "in", "nested"))
+	want := map[string]int64{"a.txt": 7, "b.txt": 7, "c/d.txt": 7}
+	if got := f.Sizes(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got=%v want=%v", got, want)
+	} else if got := f.TotalSize(); got != 21 {
+		t.Fatalf("got=%d want=%d", got, 21)
+	} else if got := (Fixtures{}).TotalSize(); got != 0 {
+		t.Fatalf("got=%d want=%d", got, 0)
+	}
+}
+
+func TestFixturesWalk(t *testing.T) {
+	f := Fixtures{}
+	for _, path := range []string{"c.txt", "a/b.txt", "b.txt", "a.txt", "a/a.txt"} {
+		f.Add([]byte(path), path)
+	}
+	var got []string
+	err := f.Walk(func(path string, data []byte) error {
+		if string(data) != path {
+			t.Errorf("got=%q want=%q", data, path)
+		}
+		got = append(got, path)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if want := f.Paths(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got=%v want=%v", got, want)
+	}
+
+	stop := errors.New("stop")
+	got = nil
+	err = f.Walk(func(path string, data []byte) error {
+		got = append(got, path)
+		if len(got) == 2 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop {
+		t.Fatalf("got=%v want=%v", err, stop)
+	} else if want := f.Paths()[:2]; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got=%v want=%v", got, want)
+	}
+}
+
+func TestTempConfig(t *testing.T) {
+	var dir string
+	t.Run("sub", func(t *testing.T) {
+		c := TempConfig(t)
+		dir = c.Dir
+		if info, err := os.Stat(dir); err != nil {
+			t.Fatal(err)
+		} else if !info.IsDir() {
+			t.Fatalf("got=%v want=true", info.IsDir())
+		} else if c.Flags != "" {
+			t.Errorf("got=%q want=%q", c.Flags, "")
+		}
+		gf := c.GoldenFixtures("out")
+		gf.Add([]byte("a"), "a.txt")
+		gf.Flags = string(FlagUpdate)
+		if err := gf.Test(); err != nil {
+			t.Fatal(err)
+		}
+		gf.Flags = ""
+		if err := gf.Test(); err != nil {
+			t.Fatal(err)
+		}
+
+		// Without a Hint, failures don't tell the user to run an empty command.
+		gf.Fixtures.Set([]byte("b"), gf.join("a.txt"))
+		if err := gf.Test(); err == nil || !strings.HasPrefix(err.Error(), "1 errors:") || strings.Contains(err.Error(), "\n\n") {
+			t.Fatalf("got=%v", err)
+		}
+	})
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("got=%v want not exist", err)
+	}
+}
+
+func TestGoldenFixturesIgnorePatterns(t *testing.T) {
+	uuid := regexp.MustCompile(`[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`)
+	duration := regexp.MustCompile(`took [0-9.]+ms`)
+	c := TempConfig(t)
+	c.IgnorePatterns = []*regexp.Regexp{uuid, duration}
+	golden := "request 0b6f4a8e-2c1d-4e5f-9a7b-3c2d1e0f9a8b took 12.5ms\nok\n"
+	if err := ioutil.WriteFile(filepath.Join(c.Dir, "a.log"), []byte(golden), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		Data string
+		Want int
+	}{
+		{Data: "request 7d3e2f1a-9b8c-4d7e-8f6a-5b4c3d2e1f0a took 3ms\nok\n", Want: 0},
+		{Data: "request 7d3e2f1a-9b8c-4d7e-8f6a-5b4c3d2e1f0a took 3ms\nfailed\n", Want: 1},
+		{Data: "request not-a-uuid took 3ms\nok\n", Want: 1},
+	}
+	for i, test := range tests {
+		gf := c.GoldenFixtures()
+		gf.Add([]byte(test.Data), "a.log")
+		if diff, err := gf.Diff(); err != nil {
+			t.Fatal(err)
+		} else if len(diff) != test.Want {
+			t.Errorf("%d: got=%d want=%d", i, len(diff), test.Want)
+		}
+	}
+
+	want := "request <ignored> <ignored>\nok\n"
+	if got := ReplacePatterns([]byte(golden), uuid, duration); string(got) != want {
+		t.Fatalf("got=%q want=%q", got, want)
+	}
+}
+
+func TestGoldenFixturesIgnoreTrailingWhitespace(t *testing.T) {
+	tmpDir := testDir(t)
+	golden := map[string]string{
+		"spaces.txt": "a  \nb\t\n",
+		"crlf.txt":   "a\r\nb\r\n",
+		"other.txt":  "a\nb\n",
+		"bin.dat":    "a \x00",
+	}
+	for name, data := range golden {
+		if err := ioutil.WriteFile(filepath.Join(tmpDir, name), []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := map[string]string{
+		"spaces.txt": "a\nb\n",
+		"crlf.txt":   "a\nb  \n",
+		"other.txt":  "a\n b\n",
+		"bin.dat":    "a\x00",
+	}
+	tests := []struct {
+		Ignore bool
+		Want   []string
+	}{
+		{Ignore: false, Want: []string{"bin.dat", "crlf.txt", "other.txt", "spaces.txt"}},
+		{Ignore: true, Want: []string{"bin.dat", "other.txt"}},
+	}
+	for _, test := range tests {
+		gf := gc.GoldenFixtures()
+		gf.Dir = tmpDir
+		gf.Flags = ""
+		gf.IgnoreTrailingWhitespace = test.Ignore
+		for name, data := range got {
+			gf.Add([]byte(data), name)
+		}
+		diff, err := gf.Diff()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var paths []string
+		for _, d := range diff {
+			paths = append(paths, filepath.Base(d.Path))
+		}
+		if !reflect.DeepEqual(paths, test.Want) {
+			t.Errorf("%v: got=%v want=%v", test.Ignore, paths, test.Want)
+		}
+	}
+
+	// Updating doesn't touch files that only differ in trailing whitespace.
+	gf := gc.GoldenFixtures()
+	gf.Dir = tmpDir
+	gf.Flags = string(FlagUpdate)
+	gf.IgnoreTrailingWhitespace = true
+	for name, data := range got {
+		gf.Add([]byte(data), name)
+	}
+	if err := gf.Test(); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"spaces.txt": golden["spaces.txt"], "other.txt": got["other.txt"]} {
+		if data, err := ioutil.ReadFile(filepath.Join(tmpDir, name)); err != nil {
+			t.Fatal(err)
+		} else if string(data) != want {
+			t.Errorf("%s: got=%q want=%q", name, data, want)
+		}
+	}
+}
+
+func TestGoldenFixturesOrphans(t *testing.T) {
+	tmpDir := testDir(t)
+	for _, name := range []string{"a.txt", "orphan.txt", ".hidden", filepath.Join("sub", "b.txt"), filepath.Join("sub", "orphan.txt")} {
+		path := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		} else if err := ioutil.WriteFile(path, []byte(name), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gf := gc.GoldenFixtures()
+	gf.Dir = tmpDir
+	gf.Flags = string(FlagUpdate)
+	gf.IgnoreUnexpected = true
+	gf.Add([]byte("a.txt"), "a.txt")
+	gf.Add([]byte("changed"), "sub", "b.txt")
+	gf.Add([]byte("missing"), "missing.txt")
+	got, err := gf.Orphans()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		fixtureKey(filepath.Join(tmpDir, "orphan.txt")),
+		fixtureKey(filepath.Join(tmpDir, "sub", "orphan.txt")),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%v want=%v", got, want)
+	} else if _, err := os.Stat(filepath.Join(tmpDir, "missing.txt")); !os.IsNotExist(err) {
+		t.Errorf("got=%v want not exist", err)
+	}
+}
+
+func TestConfigPlatformDir(t *testing.T) {
+	defer func(s string) { goos = s }(goos)
+	c := gc
+	c.Dir = testDir(t)
+	for _, dir := range []string{"out", "out-darwin"} {
+		if err := os.MkdirAll(filepath.Join(c.Dir, dir), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(c.Dir, "file-linux"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		GOOS string
+		Base string
+		Want string
+	}{
+		{GOOS: "darwin", Base: "out", Want: "out-darwin"},
+		{GOOS: "linux", Base: "out", Want: "out"},
+		{GOOS: "darwin", Base: "missing", Want: "missing"},
+		{GOOS: "linux", Base: "file", Want: "file"},
+	}
+	for _, test := range tests {
+		goos = test.GOOS
+		if got := c.PlatformDir(test.Base); got != test.Want {
+			t.Errorf("%s: %s: got=%q want=%q", test.GOOS, test.Base, got, test.Want)
+		}
+	}
+}
+
+func TestGoldenFixturesVerbose(t *testing.T) {
+	defer func(w io.Writer) { stderr = w }(stderr)
+	tmpDir := testDir(t)
+	for _, name := range []string{"a.txt", "changed.txt", "unexpected.txt"} {
+		if err := ioutil.WriteFile(filepath.Join(tmpDir, name), []byte(name), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	buf := &bytes.Buffer{}
+	stderr = buf
+	gf := gc.GoldenFixtures()
+	gf.Dir = tmpDir
+	gf.Flags = string(FlagVerbose)
+	gf.Add([]byte("a.txt"), "a.txt")
+	gf.Add([]byte("changed"), "changed.txt")
+	gf.Add([]byte("missing"), "missing.txt")
+	if err := gf.Test(); err == nil {
+		t.Fatal("got=nil want error")
+	}
+	want := "goldy: ok: " + gf.join("a.txt") + "\n" +
+		"goldy: changed: " + gf.join("changed.txt") + "\n" +
+		"goldy: missing: " + gf.join("missing.txt") + "\n" +
+		"goldy: added: " + gf.join("unexpected.txt") + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got=%q want=%q", got, want)
+	}
+}
+
+func TestGoldenFixturesOutput(t *testing.T) {
+	defer func(w io.Writer) { stderr = w }(stderr)
+	stderr = &bytes.Buffer{}
+	c := TempConfig(t)
+	buf := &bytes.Buffer{}
+	c.Output = buf
+	c.AutoCreate = true
+	c.Flags = "verbose,stats"
+	gf := c.GoldenFixtures("auto")
+	gf.Add([]byte("a"), "a.txt")
+	if err := gf.Test(); err != nil {
+		t.Fatal(err)
+	}
+	gf = c.GoldenFixtures("empty")
+	if err := gf.Test(); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+	for _, want := range []string{
+		"goldy: stats: dir=" + filepath.Join(c.Dir, "auto") + " fixtures=1 ",
+		"goldy: missing: " + fixtureKey(filepath.Join(c.Dir, "auto", "a.txt")) + "\n",
+		"goldy: creating missing golden fixtures: " + filepath.Join(c.Dir, "auto") + "\n",
+		"goldy: WARNING: no fixtures added for: " + filepath.Join(c.Dir, "empty") + "\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got=%q want=%q", got, want)
+		}
+	}
+	if got := stderr.(*bytes.Buffer).String(); got != "" {
+		t.Errorf("got=%q want=%q", got, "")
+	}
+}
+
+func TestGoldenFixturesWarnEmpty(t *testing.T) {
+	defer func(w io.Writer) { stderr = w }(stderr)
+	tests := []struct {
+		Name     string
+		Fixtures Fixtures
+		OnDisk   bool
+		Want     bool
+	}{
+		{Name: "empty", Want: true},
+		{Name: "fixtures", Fixtures: Fixtures{"a.txt": []byte("a")}},
+		{Name: "on disk", OnDisk: true},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			tmpDir := testDir(t)
+			if test.OnDisk {
+				if err := ioutil.WriteFile(filepath.Join(tmpDir, "a.txt"), []byte("a"), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			buf := &bytes.Buffer{}
+			stderr = buf
+			gf := gc.GoldenFixtures()
+			gf.Dir = tmpDir
+			gf.Flags = string(FlagUpdate)
+			for path, data := range test.Fixtures {
+				gf.Add(data, path)
+			}
+			if err := gf.Test(); err != nil {
+				t.Fatal(err)
+			}
+			want := ""
+			if test.Want {
+				want = "goldy: WARNING: no fixtures added for: " + tmpDir + "\n"
+			}
+			if got := buf.String(); got != want {
+				t.Errorf("got=%q want=%q", got, want)
+			}
+		})
+	}
+}
+
+func TestGoldenFixturesFailOnEmpty(t *testing.T) {
+	defer func(w io.Writer) { stderr = w }(stderr)
+	stderr = ioutil.Discard
+	tests := []struct {
+		Name     string
+		Fixtures Fixtures
+		OnDisk   bool
+		Flags    Flag
+		WantErr  bool
+	}{
+		{Name: "empty with data", OnDisk: true, WantErr: true},
+		{Name: "empty with data update", OnDisk: true, Flags: FlagUpdate, WantErr: true},
+		{Name: "empty with data rewrite", OnDisk: true, Flags: FlagRewrite, WantErr: true},
+		{Name: "truly empty"},
+		{Name: "fixtures", Fixtures: Fixtures{"a.txt": []byte("a")}, OnDisk: true},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			tmpDir := testDir(t)
+			if test.OnDisk {
+				if err := ioutil.WriteFile(filepath.Join(tmpDir, "a.txt"), []byte("a"), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			gf := gc.GoldenFixtures()
+			gf.Dir = tmpDir
+			gf.Flags = string(test.Flags)
+			gf.FailOnEmpty = true
+			gf.IgnoreUnexpected = true
+			for path, data := range test.Fixtures {
+				gf.Add(data, path)
+			}
+			err := gf.Test()
+			want := "no fixtures added, but 1 golden fixtures exist in: " + tmpDir
+			if test.WantErr && (err == nil || err.Error() != want) {
+				t.Errorf("got=%v want=%q", err, want)
+			} else if !test.WantErr && err != nil {
+				t.Errorf("got=%v want=nil", err)
+			} else if _, err := os.Stat(filepath.Join(tmpDir, "a.txt")); test.OnDisk && err != nil {
+				t.Errorf("got=%v want=nil", err)
+			}
+		})
+	}
+}
+
+func TestGoldenFixturesMaxFixtureSize(t *testing.T) {
+	tmpDir := testDir(t)
+	if err := ioutil.WriteFile(filepath.Join(tmpDir, "disk.txt"), []byte("12345"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		Name    string
+		Max     int64
+		Data    string
+		WantErr string
+	}{
+		{Name: "unlimited", Max: 0, Data: "123456"},
+		{Name: "at limit", Max: 5, Data: "1234x"},
+		{Name: "fixture over limit", Max: 5, Data: "123456", WantErr: "fixture too large: " + fixtureKey(filepath.Join(tmpDir, "disk.txt")) + " (6 bytes, limit 5)"},
+		{Name: "disk over limit", Max: 4, Data: "1234", WantErr: "failed to load golden fixtures: fixture too large: " + filepath.Join(tmpDir, "disk.txt") + " (5 bytes, limit 4)"},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			gf := gc.GoldenFixtures()
+			gf.Dir = tmpDir
+			gf.Flags = string(FlagUpdate) + "," + string(FlagDryRun)
+			gf.MaxFixtureSize = test.Max
+			gf.Add([]byte(test.Data), "disk.txt")
+			err := gf.Test()
+			if test.WantErr == "" {
+				if err == nil || !strings.HasPrefix(err.Error(), "dry-run: ") {
+					t.Errorf("got=%v want dry-run error", err)
+				}
+			} else if err == nil || err.Error() != test.WantErr {
+				t.Errorf("got=%v want=%q", err, test.WantErr)
+			}
+		})
+	}
+}
+
+func TestFixturesRename(t *testing.T) {
+	f := Fixtures{
+		"in/a.input.txt": []byte("a"),
+		"in/b.input.txt": []byte("b"),
+		"in/c.golden":    []byte("c"),
+	}
+	tests := []struct {
+		Name    string
+		Fn      func(string) (string, bool)
+		Want    Fixtures
+		WantErr string
+	}{
+		{
+			Name: "remap",
+			Fn: func(path string) (string, bool) {
+				return strings.Replace(path, "in/", "out/", 1), true
+			},
+			Want: Fixtures{
+				"out/a.input.txt": []byte("a"),
+				"out/b.input.txt": []byte("b"),
+				"out/c.golden":    []byte("c"),
+			},
+		},
+		{
+			Name: "drop",
+			Fn: func(path string) (string, bool) {
+				return "./" + strings.Replace(path, ".input", ".golden", 1), !strings.HasSuffix(path, ".golden")
+			},
+			Want: Fixtures{
+				"in/a.golden.txt": []byte("a"),
+				"in/b.golden.txt": []byte("b"),
+			},
+		},
+		{
+			Name: "collision",
+			Fn: func(path string) (string, bool) {
+				return "same.txt", true
+			},
+			WantErr: "rename collision: in/a.input.txt and in/b.input.txt both map to same.txt",
+		},
+	}
+	for _, test := range tests {
+		got, err := f.Rename(test.Fn)
+		if test.WantErr != "" {
+			if err == nil || err.Error() != test.WantErr {
+				t.Errorf("%s: got=%v want=%q", test.Name, err, test.WantErr)
+			}
+		} else if err != nil {
+			t.Errorf("%s: %s", test.Name, err)
+		} else if !reflect.DeepEqual(got, test.Want) {
+			t.Errorf("%s: got=%v want=%v", test.Name, got, test.Want)
+		}
+	}
+}
+
+func TestGoldenFixturesReference(t *testing.T) {
+	tmpDir := testDir(t)
+	if err := ioutil.WriteFile(filepath.Join(tmpDir, "disk.txt"), []byte("disk"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	calls := map[string]int{}
+	gf := gc.GoldenFixtures()
+	gf.Dir = tmpDir
+	gf.Flags = ""
+	gf.Reference = func(path string) ([]byte, error) {
+		calls[path]++
+		if filepath.Base(path) == "broken.txt" {
+			return nil, errors.New("exit status 1")
+		}
+		return []byte("ref:" + filepath.Base(path)), nil
+	}
+	gf.Add([]byte("disk"), "disk.txt")
+	gf.Add([]byte("ref:a.txt"), "a.txt")
+	gf.Add([]byte("other"), "b.txt")
+	for i := 0; i < 2; i++ {
+		diff, err := gf.Diff()
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := diff.String(), "changed file: "+gf.join("b.txt"); got != want {
+			t.Fatalf("got=%q want=%q", got, want)
+		} else if string(diff[0].A) != "ref:b.txt" {
+			t.Fatalf("got=%q want=%q", diff[0].A, "ref:b.txt")
+		}
+	}
+	want := map[string]int{gf.join("a.txt"): 1, gf.join("b.txt"): 1}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("got=%v want=%v", calls, want)
+	}
+
+	gf.Add([]byte("x"), "broken.txt")
+	wantErr := "failed to get reference: " + gf.join("broken.txt") + ": exit status 1"
+	if _, err := gf.Diff(); err == nil || err.Error() != wantErr {
+		t.Errorf("got=%v want=%q", err, wantErr)
+	}
+}
+
+func TestGoldenFixturesReferenceUpdate(t *testing.T) {
+	c := TempConfig(t)
+	c.Reference = func(path string) ([]byte, error) {
+		return []byte("ref"), nil
+	}
+	gf := c.GoldenFixtures()
+	gf.Add([]byte("ref"), "a.txt")
+	if err := gf.Test(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Updates write fixtures matching the reference, which then take
+	// precedence.
+	gf.Flags = string(FlagUpdate)
+	if err := gf.Test(); err != nil {
+		t.Fatal(err)
+	} else if data, err := ioutil.ReadFile(filepath.Join(c.Dir, "a.txt")); err != nil {
+		t.Fatal(err)
+	} else if string(data) != "ref" {
+		t.Fatalf("got=%q want=%q", data, "ref")
+	}
+	gf = c.GoldenFixtures()
+	gf.Reference = func(path string) ([]byte, error) {
+		return []byte("changed ref"), nil
+	}
+	gf.Add([]byte("ref"), "a.txt")
+	if err := gf.Test(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGoldenFixturesUpdatePreservesMtime(t *testing.T) {
+	tmpDir := testDir(t)
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for _, name := range []string{"same.txt", "normalized.txt", "changed.txt"} {
+		path := filepath.Join(tmpDir, name)
+		if err := ioutil.WriteFile(path, []byte(name), 0600); err != nil {
+			t.Fatal(err)
+		} else if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var logs []string
+	gf := gc.GoldenFixtures()
+	gf.Dir = tmpDir
+	gf.Flags = string(FlagUpdate)
+	gf.Logf = func(format string, args ...interface{}) {
+		if msg := fmt.Sprintf(format, args...); !strings.HasPrefix(msg, "goldy: loaded: ") {
+			logs = append(logs, msg)
+		}
+	}
+	gf.Add([]byte("same.txt"), "same.txt")
+	gf.Add([]byte("normalized.txt"), "normalized.txt")
+	gf.Add([]byte("new"), "changed.txt")
+	// Normalizing the golden fixture causes a diff even though the file on
+	// disk already holds the fixture.
+	gf.normalize = map[string]func([]byte) []byte{
+		gf.join("normalized.txt"): bytes.ToUpper,
+	}
+	if err := gf.Test(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"goldy: diff: changed: " + gf.join("changed.txt"),
+		"goldy: diff: changed: " + gf.join("normalized.txt"),
+		"goldy: wrote: " + gf.join("changed.txt"),
+		"goldy: unchanged: " + gf.join("normalized.txt"),
+	}
+	if !reflect.DeepEqual(logs, want) {
+		t.Errorf("got=%q want=%q", logs, want)
+	}
+	for name, wantOld := range map[string]bool{"same.txt": true, "normalized.txt": true, "changed.txt": false} {
+		info, err := os.Stat(filepath.Join(tmpDir, name))
+		if err != nil {
+			t.Fatal(err)
+		} else if gotOld := info.ModTime().Equal(old); gotOld != wantOld {
+			t.Errorf("%s: got=%v want=%v", name, gotOld, wantOld)
+		}
+	}
+}
+
+func TestGoldenFixturesDiffHint(t *testing.T) {
+	tmpDir := testDir(t)
+	for name, data := range map[string]string{"a.txt": "a", "b.bin": "b\x00"} {
+		if err := ioutil.WriteFile(filepath.Join(tmpDir, name), []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	diffHint := "\nrun `GOLDY=diff go test` to show the diffs of the changed files above"
+	tests := []struct {
+		Name          string
+		Flags         string
+		AutoDiffLimit int
+		Text          bool
+		WantHint      bool
+	}{
+		{Name: "hidden text diff", Text: true, WantHint: true},
+		{Name: "auto diff", Text: true, AutoDiffLimit: DefaultAutoDiffLimit},
+		{Name: "diff flag", Text: true, Flags: string(FlagDiff)},
+		{Name: "binary only"},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			gf := EnvConfig("GOLDY").GoldenFixtures()
+			gf.Dir = tmpDir
+			gf.Flags = test.Flags
+			gf.AutoDiffLimit = test.AutoDiffLimit
+			if test.Text {
+				gf.Add([]byte("b"), "a.txt")
+			} else {
+				gf.Add([]byte("a\x00"), "a.txt")
+			}
+			gf.Add([]byte("changed\x00"), "b.bin")
+			err := gf.Test()
+			if err == nil {
+				t.Fatal("got=nil want error")
+			}
+			wantSuffix := "\n\nrun `GOLDY=update go test` to automatically update all files above"
+			if test.WantHint {
+				wantSuffix += diffHint
+			}
+			if !strings.HasSuffix(err.Error(), wantSuffix) {
+				t.Errorf("got=%q want suffix=%q", err, wantSuffix)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package goldy
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// Hunk is a group of changed lines and their surrounding context lines, like
+// a hunk in a unified diff. See FileDiff.Hunks.
+type Hunk struct {
+	// AStart and BStart are the 1-based numbers of the first line of the hunk
+	// in A and B, ALines and BLines the number of lines it covers in each, as
+	// in the "@@ -AStart,ALines +BStart,BLines @@" header of a unified diff.
+	AStart int `json:"a_start"`
+	ALines int `json:"a_lines"`
+	BStart int `json:"b_start"`
+	BLines int `json:"b_lines"`
+	// Lines holds the context, removed and added lines of the hunk in order.
+	Lines []HunkLine `json:"lines"`
+}
+
+// HunkLine is a single line of a Hunk.
+type HunkLine struct {
+	// Op is ' ' for context lines, '-' for lines only in A and '+' for lines
+	// only in B.
+	Op byte `json:"op"`
+	// Text is the content of the line without its trailing newline.
+	Text string `json:"text"`
+}
+
+// Hunks returns the hunks of a line based diff from d.A to d.B with 3 lines
+// of context. It returns nil if d.A and d.B are equal or if either of them
+// is binary, see isBinary.
+func (d *FileDiff) Hunks() []Hunk {
+	if bytes.Equal(d.A, d.B) || isBinary(d.A) || isBinary(d.B) {
+		return nil
+	}
+	a, b := splitLines(d.A), splitLines(d.B)
+	var hunks []Hunk
+	for _, group := range difflib.NewMatcher(a, b).GetGroupedOpCodes(3) {
+		first, last := group[0], group[len(group)-1]
+		h := Hunk{
+			AStart: first.I1 + 1,
+			ALines: last.I2 - first.I1,
+			BStart: first.J1 + 1,
+			BLines: last.J2 - first.J1,
+		}
+		// Empty ranges start at the line before them, like in unified diffs.
+		if h.ALines == 0 {
+			h.AStart--
+		}
+		if h.BLines == 0 {
+			h.BStart--
+		}
+		for _, op := range group {
+			if op.Tag == 'e' {
+				h.Lines = appendHunkLines(h.Lines, ' ', a[op.I1:op.I2])
+				continue
+			}
+			if op.Tag == 'r' || op.Tag == 'd' {
+				h.Lines = appendHunkLines(h.Lines, '-', a[op.I1:op.I2])
+			}
+			if op.Tag == 'r' || op.Tag == 'i' {
+				h.Lines = appendHunkLines(h.Lines, '+', b[op.J1:op.J2])
+			}
+		}
+		hunks = append(hunks, h)
+	}
+	return hunks
+}
+
+// appendHunkLines appends a HunkLine with the given op for every line to
+// lines.
+func appendHunkLines(lines []HunkLine, op byte, text []string) []HunkLine {
+	for _, t := range text {
+		lines = append(lines, HunkLine{Op: op, Text: strings.TrimSuffix(t, "\n")})
+	}
+	return lines
+}
+
+// splitLines splits data into lines that keep their trailing newline. Unlike
+// difflib.SplitLines, it doesn't add an empty line after a trailing newline.
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,67 @@
+package goldy
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFileDiffHunks(t *testing.T) {
+	var lines []string
+	for i := 1; i <= 20; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	a := strings.Join(lines, "\n") + "\n"
+	b := strings.Replace(a, "line 5\n", "line five\n", 1)
+	b = strings.Replace(b, "line 18\n", "", 1)
+
+	tests := []struct {
+		Name string
+		Diff FileDiff
+		Want []Hunk
+	}{
+		{
+			Name: "edit",
+			Diff: FileDiff{Kind: DiffChanged, A: []byte(a), B: []byte(b)},
+			Want: []Hunk{
+				{
+					AStart: 2, ALines: 7, BStart: 2, BLines: 7,
+					Lines: []HunkLine{
+						{' ', "line 2"}, {' ', "line 3"}, {' ', "line 4"},
+						{'-', "line 5"}, {'+', "line five"},
+						{' ', "line 6"}, {' ', "line 7"}, {' ', "line 8"},
+					},
+				},
+				{
+					AStart: 15, ALines: 6, BStart: 15, BLines: 5,
+					Lines: []HunkLine{
+						{' ', "line 15"}, {' ', "line 16"}, {' ', "line 17"},
+						{'-', "line 18"},
+						{' ', "line 19"}, {' ', "line 20"},
+					},
+				},
+			},
+		},
+		{
+			Name: "missing",
+			Diff: FileDiff{Kind: DiffMissing, B: []byte("a\nb")},
+			Want: []Hunk{
+				{AStart: 0, ALines: 0, BStart: 1, BLines: 2, Lines: []HunkLine{{'+', "a"}, {'+', "b"}}},
+			},
+		},
+		{
+			Name: "equal",
+			Diff: FileDiff{Kind: DiffModeChanged, A: []byte("a\n"), B: []byte("a\n")},
+		},
+		{
+			Name: "binary",
+			Diff: FileDiff{Kind: DiffChanged, A: []byte("a\x00"), B: []byte("b\x00")},
+		},
+	}
+	for _, test := range tests {
+		if got := test.Diff.Hunks(); !reflect.DeepEqual(got, test.Want) {
+			t.Errorf("%s: got=%+v want=%+v", test.Name, got, test.Want)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package goldy
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// stdin is where FlagInteractive reads answers from. It's a variable so tests
+// can replace it.
+var stdin io.Reader = os.Stdin
+
+// interactive implements FlagInteractive. It prompts for every entry in diff
+// and returns the accepted entries and the rejected ones, which include all
+// entries left after quitting.
+func (gf *GoldenFixtures) interactive(diff Diff) (accepted, rejected Diff, err error) {
+	if len(diff) == 0 {
+		return nil, nil, nil
+	} else if f, ok := stdin.(*os.File); ok && !isTerminal(f) {
+		return nil, diff, errors.New("interactive: stdin is not a terminal")
+	}
+	in, out := bufio.NewReader(stdin), gf.output()
+	for i, d := range diff {
+		fmt.Fprintf(out, "%s\n", d.summary(gf.displayPath(d.Path)))
+		if d.Kind == DiffChanged && d.Detail == "" && !isBinary(d.A) && !isBinary(d.B) {
+			fmt.Fprintf(out, "%s\n", renderDiff(d.A, d.B, gf.diffContext(), false))
+		} else if strings.Contains(d.Detail, "\n") {
+			fmt.Fprintf(out, "%s\n", indent(d.Detail))
+		}
+		answer, err := prompt(in, out, "accept? [y/n/q] ")
+		if err != nil {
+			return accepted, append(rejected, diff[i:]...), err
+		}
+		switch answer {
+		case "y":
+			accepted = append(accepted, d)
+		case "n":
+			rejected = append(rejected, d)
+		case "q":
+			return accepted, append(rejected, diff[i:]...), nil
+		}
+	}
+	return accepted, rejected, nil
+}
+
+// prompt writes msg to out and reads lines from in until one of them is
+// "y", "n" or "q", which is returned. EOF is treated as "q".
+func prompt(in *bufio.Reader, out io.Writer, msg string) (string, error) {
+	for {
+		fmt.Fprint(out, msg)
+		line, err := in.ReadString('\n')
+		if answer := strings.ToLower(strings.TrimSpace(line)); answer == "y" || answer == "n" || answer == "q" {
+			return answer, nil
+		} else if err == io.EOF {
+			fmt.Fprintln(out)
+			return "q", nil
+		} else if err != nil {
+			return "", fmt.Errorf("interactive: %w", err)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package goldy
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGoldenFixturesInteractive(t *testing.T) {
+	defer func(r io.Reader) { stdin = r }(stdin)
+	defer func(w io.Writer) { stderr = w }(stderr)
+
+	tests := []struct {
+		Name      string
+		Input     string
+		WantFiles map[string]string
+		WantErr   string
+	}{
+		{
+			Name:  "accept all",
+			Input: "y\ny\ny\n",
+			WantFiles: map[string]string{
+				"changed.txt": "new",
+				"missing.txt": "missing",
+			},
+		},
+		{
+			Name:  "reject some",
+			Input: "x\nn\nY\nn\n",
+			WantFiles: map[string]string{
+				"changed.txt":    "old",
+				"missing.txt":    "missing",
+				"unexpected.txt": "unexpected",
+			},
+			WantErr: "2 errors:\nchanged file: ",
+		},
+		{
+			Name:  "quit",
+			Input: "y\nq\n",
+			WantFiles: map[string]string{
+				"changed.txt":    "new",
+				"unexpected.txt": "unexpected",
+			},
+			WantErr: "2 errors:\nmissing file: ",
+		},
+		{
+			Name:  "eof",
+			Input: "",
+			WantFiles: map[string]string{
+				"changed.txt":    "old",
+				"unexpected.txt": "unexpected",
+			},
+			WantErr: "3 errors:\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			tmpDir := testDir(t)
+			for name, data := range map[string]string{"changed.txt": "old", "unexpected.txt": "unexpected"} {
+				if err := ioutil.WriteFile(filepath.Join(tmpDir, name), []byte(data), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			stdin = strings.NewReader(test.Input)
+			buf := &bytes.Buffer{}
+			stderr = buf
+
+			gf := gc.GoldenFixtures()
+			gf.Dir = tmpDir
+			gf.Flags = string(FlagInteractive)
+			gf.Add([]byte("new"), "changed.txt")
+			gf.Add([]byte("missing"), "missing.txt")
+			err := gf.Test()
+			if test.WantErr == "" && err != nil {
+				t.Fatal(err)
+			} else if test.WantErr != "" && (err == nil || !strings.HasPrefix(err.Error(), test.WantErr)) {
+				t.Fatalf("got=%v want=%q", err, test.WantErr)
+			} else if !strings.Contains(buf.String(), "accept? [y/n/q] ") {
+				t.Errorf("got=%q want prompt", buf.String())
+			}
+			got, err := Load(tmpDir, IsDotfile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = got.Sub(tmpDir)
+			if len(got) != len(test.WantFiles) {
+				t.Errorf("got=%v want=%v", got.Paths(), test.WantFiles)
+			}
+			for name, data := range test.WantFiles {
+				if string(got[name]) != data {
+					t.Errorf("%s: got=%q want=%q", name, got[name], data)
+				}
+			}
+		})
+	}
+
+	t.Run("not a terminal", func(t *testing.T) {
+		defer func(fn func(*os.File) bool) { isTerminal = fn }(isTerminal)
+		isTerminal = func(*os.File) bool { return false }
+		stdin = os.Stdin
+		gf := gc.GoldenFixtures()
+		gf.Dir = testDir(t)
+		gf.Flags = string(FlagInteractive)
+		gf.Add([]byte("a"), "a.txt")
+		want := "interactive: stdin is not a terminal"
+		if err := gf.Test(); err == nil || err.Error() != want {
+			t.Errorf("got=%v want=%q", err, want)
+		}
+	})
+}
@@ -0,0 +1,363 @@
+package goldy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Load loads a Fixtures from the given path. The exclude func is called for every
+// file and allows excluding paths by returning false.
+func Load(path string, exclude func(path string) bool) (Fixtures, error) {
+	return LoadContext(context.Background(), path, exclude)
+}
+
+// LoadContext is like Load, but aborts loading with ctx.Err() once ctx is
+// done.
+func LoadContext(ctx context.Context, path string, exclude func(path string) bool) (Fixtures, error) {
+	l := &loader{ctx: ctx, exclude: exclude}
+	s, _, err := l.load(path)
+	return s, err
+}
+
+// LoadParallel is like Load, but reads the files using the given number of
+// concurrent workers, which can be faster for large trees or slow file
+// systems. If workers is <= 0, runtime.GOMAXPROCS(0) workers are used.
+func LoadParallel(path string, exclude func(path string) bool, workers int) (Fixtures, error) {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	var paths []string
+	if err := filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		} else if info.IsDir() || exclude(path) {
+			return nil
+		}
+		paths = append(paths, path)
+		return nil
+	}); err != nil {
+		return Fixtures{}, err
+	}
+
+	var (
+		s        = Fixtures{}
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+		work     = make(chan string)
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range work {
+				data, err := ioutil.ReadFile(path)
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+				} else if err == nil {
+					s[fixtureKey(path)] = data
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, path := range paths {
+		work <- path
+	}
+	close(work)
+	wg.Wait()
+	return s, firstErr
+}
+
+// LoadModes is like Load, but also returns the permission bits of every
+// loaded file.
+func LoadModes(path string, exclude func(path string) bool) (Fixtures, map[string]os.FileMode, error) {
+	l := &loader{ctx: context.Background(), exclude: exclude}
+	return l.load(path)
+}
+
+// DiffDirs loads the directories a and b and returns the diff between them
+// with paths relative to the directories. It's equivalent to
+// a.DiffWith(b, DiffOptions{SwapSides: true}) on the loaded Fixtures, i.e.
+// A and B hold the contents from a and b, files only in b are DiffMissing
+// and files only in a are DiffUnexpected. If exclude is nil, IsDotfile is
+// used.
+func DiffDirs(a, b string, exclude func(path string) bool) (Diff, error) {
+	if exclude == nil {
+		exclude = IsDotfile
+	}
+	fa, err := Load(a, exclude)
+	if err != nil {
+		return nil, err
+	}
+	fb, err := Load(b, exclude)
+	if err != nil {
+		return nil, err
+	}
+	return fa.Sub(a).DiffWith(fb.Sub(b), DiffOptions{SwapSides: true}), nil
+}
+
+// loader implements loading fixtures from disk for Load and its variants.
+type loader struct {
+	ctx         context.Context
+	exclude     func(path string) bool
+	excludeInfo func(path string, info os.FileInfo) bool
+	// excludeContent, if not nil, is called with the content of every file
+	// after reading it.
+	excludeContent func(path string, data []byte) bool
+	// decompress causes files with a ".gz" suffix to be decompressed and
+	// loaded without the suffix.
+	decompress bool
+	// decodeBase64 causes files with a ".b64" suffix to be decoded and loaded
+	// without the suffix. It's applied before decompress.
+	decodeBase64 bool
+	// streamThreshold is the file size above which files are compared against
+	// their counterpart in got in chunks before reading them into memory. If
+	// they are equal, the data from got is used instead. 0 disables this.
+	streamThreshold int64
+	got             Fixtures
+	// followSymlinks causes symlinks to directories to be followed, see
+	// walkFollow.
+	followSymlinks bool
+	// readRetries is the number of times reading a file is retried after a
+	// transient error, see readFile.
+	readRetries int
+	// maxSize, if > 0, causes loading to fail for files larger than it.
+	maxSize int64
+	// logf, if not nil, is used to log excluded and loaded files.
+	logf func(format string, args ...interface{})
+}
+
+// load loads the fixtures and their permission bits from the given path.
+func (l *loader) load(path string) (Fixtures, map[string]os.FileMode, error) {
+	s := Fixtures{}
+	modes := map[string]os.FileMode{}
+	walk := filepath.Walk
+	if l.followSymlinks {
+		walk = walkFollow
+	}
+	return s, modes, walk(path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		} else if err := l.ctx.Err(); err != nil {
+			return err
+		} else if info.IsDir() {
+			return nil
+		} else if l.exclude(path) || (l.excludeInfo != nil && l.excludeInfo(path, info)) {
+			l.log("goldy: excluded: %s", path)
+			return nil
+		}
+		if l.maxSize > 0 && info.Size() > l.maxSize {
+			return sizeError(path, info.Size(), l.maxSize)
+		}
+		key := fixtureKey(path)
+		b64 := l.decodeBase64 && strings.HasSuffix(key, ".b64")
+		if b64 {
+			key = strings.TrimSuffix(key, ".b64")
+		}
+		gz := l.decompress && strings.HasSuffix(key, ".gz")
+		if gz {
+			key = strings.TrimSuffix(key, ".gz")
+		}
+		if _, ok := s[key]; ok {
+			return fmt.Errorf("duplicate fixture: %s", key)
+		}
+		if got, ok := l.got[key]; ok && !gz && !b64 && l.streamThreshold > 0 &&
+			info.Size() > l.streamThreshold && int64(len(got)) == info.Size() {
+			if equal, err := equalFile(path, got); err != nil {
+				return err
+			} else if equal && l.excludeContent != nil && l.excludeContent(path, got) {
+				l.log("goldy: excluded: %s", path)
+				return nil
+			} else if equal {
+				l.log("goldy: loaded: %s (streamed)", path)
+				s[key] = got
+				modes[key] = info.Mode().Perm()
+				return nil
+			}
+		}
+		data, err := l.readFile(path)
+		if err != nil {
+			return err
+		} else if b64 {
+			if data, err = unbase64Data(data); err != nil {
+				return fmt.Errorf("could not decode: %s: %s", path, err)
+			}
+		}
+		if gz {
+			if data, err = gunzipData(data); err != nil {
+				return fmt.Errorf("could not decompress: %s: %s", path, err)
+			}
+		}
+		if l.excludeContent != nil && l.excludeContent(path, data) {
+			l.log("goldy: excluded: %s", path)
+			return nil
+		}
+		l.log("goldy: loaded: %s", path)
+		s[key] = data
+		modes[key] = info.Mode().Perm()
+		return nil
+	})
+}
+
+// log calls l.logf if it is set.
+func (l *loader) log(format string, args ...interface{}) {
+	if l.logf != nil {
+		l.logf(format, args...)
+	}
+}
+
+// walkFollow is like filepath.Walk, but follows symlinks to directories and
+// passes the os.FileInfo of the symlink targets to fn. The paths passed to fn
+// are inside of root, even for files reached via symlinks. An error is
+// returned if a symlink points to one of the directories containing it.
+func walkFollow(root string, fn filepath.WalkFunc) error {
+	return walkFollowDir(root, map[string]bool{}, fn)
+}
+
+// walkFollowDir implements walkFollow. active holds the resolved paths of the
+// dirs that are currently being walked and is used to detect cycles.
+func walkFollowDir(path string, active map[string]bool, fn filepath.WalkFunc) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fn(path, info, err)
+	} else if !info.IsDir() {
+		return fn(path, info, nil)
+	}
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return fn(path, info, err)
+	} else if real, err = filepath.Abs(real); err != nil {
+		return fn(path, info, err)
+	} else if active[real] {
+		return fmt.Errorf("symlink cycle: %s -> %s", path, real)
+	}
+	active[real] = true
+	defer delete(active, real)
+	if err := fn(path, info, nil); err != nil {
+		return err
+	}
+	infos, err := ioutil.ReadDir(path)
+	if err != nil {
+		return fn(path, info, err)
+	}
+	for _, info := range infos {
+		if err := walkFollowDir(filepath.Join(path, info.Name()), active, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var (
+	// readFile is used by loader for reading files. It's a variable so tests
+	// can replace it.
+	readFile = ioutil.ReadFile
+	// readBackoff is the time loader waits before the first retry of a failed
+	// read. It doubles with every retry.
+	readBackoff = 10 * time.Millisecond
+)
+
+// readFile reads the file at the given path and retries up to l.readRetries
+// times if that fails with a transient error.
+func (l *loader) readFile(path string) ([]byte, error) {
+	backoff := readBackoff
+	for i := 0; ; i++ {
+		data, err := readFile(path)
+		if err == nil || i >= l.readRetries || !isTransient(err) {
+			return data, err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// isTransient returns true if err is a filesystem error that may go away when
+// retrying the operation.
+func isTransient(err error) bool {
+	return errors.Is(err, syscall.EAGAIN) ||
+		errors.Is(err, syscall.EBUSY) ||
+		errors.Is(err, syscall.EINTR)
+}
+
+// streamChunkSize is the size of the chunks used by equalFile.
+const streamChunkSize = 64 * 1024
+
+// equalFile returns true if the file at the given path holds data. The file
+// is read in chunks rather than loading it into memory.
+func equalFile(path string, data []byte) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	buf := make([]byte, streamChunkSize)
+	for {
+		n, err := io.ReadFull(file, buf)
+		if n > len(data) || !bytes.Equal(buf[:n], data[:n]) {
+			return false, nil
+		}
+		data = data[n:]
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return len(data) == 0, nil
+		} else if err != nil {
+			return false, err
+		}
+	}
+}
+
+// ExcludeAny returns an exclude func that excludes a path if any of the given
+// funcs excludes it.
+func ExcludeAny(funcs ...func(path string) bool) func(path string) bool {
+	return func(path string) bool {
+		for _, fn := range funcs {
+			if fn(path) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// ExcludeGlob returns an exclude func that excludes a path if its base name
+// matches any of the given patterns using filepath.Match. It panics if a
+// pattern is malformed.
+func ExcludeGlob(patterns ...string) func(path string) bool {
+	for _, pattern := range patterns {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			panic(fmt.Sprintf("goldy: bad exclude pattern: %q: %s", pattern, err))
+		}
+	}
+	return func(path string) bool {
+		base := filepath.Base(path)
+		for _, pattern := range patterns {
+			if ok, _ := filepath.Match(pattern, base); ok {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// ExcludeEmpty is an ExcludeContent func that excludes empty files.
+func ExcludeEmpty(path string, data []byte) bool {
+	return len(data) == 0
+}
+
+// IsDotfile returns true if path starts with a ".". This is useful for
+// excluding hidden files on Unix / Linux, e.g. vim undo files.
+func IsDotfile(path string) bool {
+	return strings.HasPrefix(filepath.Base(path), ".")
+}
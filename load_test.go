@@ -0,0 +1,410 @@
+package goldy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestLoadContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var loaded []string
+	dir := filepath.Join(gc.Dir, "in", "nested")
+	_, err := LoadContext(ctx, dir, func(path string) bool {
+		loaded = append(loaded, path)
+		cancel()
+		return false
+	})
+	if err != context.Canceled {
+		t.Fatalf("got err=%v want=%v", err, context.Canceled)
+	} else if len(loaded) != 1 {
+		t.Fatalf("got %d loaded files want 1: %v", len(loaded), loaded)
+	}
+
+	if fixtures, err := LoadContext(context.Background(), dir, IsDotfile); err != nil {
+		t.Fatal(err)
+	} else if len(fixtures) != 3 {
+		t.Fatalf("got %d fixtures want 3", len(fixtures))
+	}
+}
+
+func TestLoadParallel(t *testing.T) {
+	dir := filepath.Join(gc.Dir, "in", "nested")
+	want, err := Load(dir, IsDotfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, workers := range []int{0, 1, 2, 8} {
+		got, err := LoadParallel(dir, IsDotfile, workers)
+		if err != nil {
+			t.Errorf("workers=%d: %s", workers, err)
+		} else if !reflect.DeepEqual(got, want) {
+			t.Errorf("workers=%d: got=%#v want=%#v", workers, got, want)
+		}
+	}
+}
+
+func BenchmarkLoad(b *testing.B) {
+	dir := filepath.Join(gc.Dir, "in", "nested")
+	b.Run("serial", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := Load(dir, IsDotfile); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("parallel", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := LoadParallel(dir, IsDotfile, 0); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestDiffDirs(t *testing.T) {
+	flat := filepath.Join(gc.Dir, "in", "flat")
+	nested := filepath.Join(gc.Dir, "in", "nested")
+	tests := []struct {
+		A, B    string
+		Exclude func(path string) bool
+		Want    Diff
+	}{
+		{A: flat, B: flat, Want: nil},
+		{A: flat, B: nested, Want: Diff{{Path: "c/d.txt", Kind: DiffMissing, B: []byte("file d\n")}}},
+		{A: nested, B: flat, Want: Diff{{Path: "c/d.txt", Kind: DiffUnexpected, A: []byte("file d\n")}}},
+		{A: flat, B: nested, Exclude: ExcludeGlob("d.txt"), Want: nil},
+	}
+	for i, test := range tests {
+		got, err := DiffDirs(test.A, test.B, test.Exclude)
+		if err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(got, test.Want) {
+			t.Errorf("%d: got=%v want=%v", i, got, test.Want)
+		}
+	}
+	if _, err := DiffDirs(flat, filepath.Join(gc.Dir, "in", "missing"), nil); !os.IsNotExist(err) {
+		t.Errorf("got=%v want not exist", err)
+	}
+}
+
+func TestLoadCleanKeys(t *testing.T) {
+	dir := filepath.Join(gc.Dir, "in", "nested")
+	want, err := Load(dir, IsDotfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unclean := "." + string(filepath.Separator) + dir + string(filepath.Separator)
+	got, err := Load(unclean, IsDotfile)
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(got.Paths(), want.Paths()) {
+		t.Fatalf("got=%v want=%v", got.Paths(), want.Paths())
+	}
+	if got, err := LoadParallel(unclean, IsDotfile, 2); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(got.Paths(), want.Paths()) {
+		t.Fatalf("got=%v want=%v", got.Paths(), want.Paths())
+	}
+}
+
+func TestGoldenFixturesStreamThreshold(t *testing.T) {
+	tmpDir := testDir(t)
+	data := bytes.Repeat([]byte("0123456789abcdef"), streamChunkSize/4)
+	if err := ioutil.WriteFile(filepath.Join(tmpDir, "large.txt"), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		Data     []byte
+		WantKind DiffKind
+	}{
+		{Data: data},
+		{Data: append(append([]byte{}, data[:len(data)-1]...), 'x'), WantKind: DiffChanged},
+		{Data: data[:len(data)-1], WantKind: DiffChanged},
+		{Data: append(append([]byte{}, data...), 'x'), WantKind: DiffChanged},
+	}
+	for i, test := range tests {
+		gf := gc.GoldenFixtures()
+		gf.Dir = tmpDir
+		gf.StreamThreshold = 1024
+		gf.Add(test.Data, "large.txt")
+		diff, err := gf.Diff()
+		if err != nil {
+			t.Fatal(err)
+		} else if test.WantKind == "" && len(diff) != 0 {
+			t.Errorf("%d: got=%v want no diff", i, diff)
+		} else if test.WantKind != "" && (len(diff) != 1 || diff[0].Kind != test.WantKind) {
+			t.Errorf("%d: got=%v want=%s", i, diff, test.WantKind)
+		} else if test.WantKind != "" && !bytes.Equal(diff[0].A, data) {
+			t.Errorf("%d: got %d golden bytes want=%d", i, len(diff[0].A), len(data))
+		}
+	}
+}
+
+func BenchmarkGoldenFixturesStreamThreshold(b *testing.B) {
+	tmpDir, err := ioutil.TempDir("", "goldy")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	data := bytes.Repeat([]byte("0123456789abcdef"), 1024*1024)
+	if err := ioutil.WriteFile(filepath.Join(tmpDir, "large.txt"), data, 0600); err != nil {
+		b.Fatal(err)
+	}
+	for _, threshold := range []int64{0, 1024} {
+		b.Run(fmt.Sprintf("threshold=%d", threshold), func(b *testing.B) {
+			b.ReportAllocs()
+			gf := gc.GoldenFixtures()
+			gf.Dir = tmpDir
+			gf.StreamThreshold = threshold
+			gf.Add(data, "large.txt")
+			for i := 0; i < b.N; i++ {
+				if diff, err := gf.Diff(); err != nil {
+					b.Fatal(err)
+				} else if len(diff) != 0 {
+					b.Fatalf("got=%v want no diff", diff)
+				}
+			}
+		})
+	}
+}
+
+func TestGoldenFixturesExcludeInfo(t *testing.T) {
+	tmpDir := testDir(t)
+	files := []struct {
+		Name string
+		Data string
+		Mode os.FileMode
+	}{
+		{"small.txt", "a", 0600},
+		{"large.txt", "aaaaaaaaaa", 0600},
+		{"script.sh", "b", 0700},
+	}
+	for _, f := range files {
+		path := filepath.Join(tmpDir, f.Name)
+		if err := ioutil.WriteFile(path, []byte(f.Data), f.Mode); err != nil {
+			t.Fatal(err)
+		} else if err := os.Chmod(path, f.Mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		Name        string
+		Exclude     func(path string) bool
+		ExcludeInfo func(path string, info os.FileInfo) bool
+		Want        []string
+	}{
+		{
+			Name:        "size",
+			ExcludeInfo: func(_ string, info os.FileInfo) bool { return info.Size() > 5 },
+			Want:        []string{"script.sh", "small.txt"},
+		},
+		{
+			Name:        "mode",
+			ExcludeInfo: func(_ string, info os.FileInfo) bool { return info.Mode()&0100 != 0 },
+			Want:        []string{"large.txt", "small.txt"},
+		},
+		{
+			Name:        "either",
+			Exclude:     ExcludeGlob("small.txt"),
+			ExcludeInfo: func(_ string, info os.FileInfo) bool { return info.Mode()&0100 != 0 },
+			Want:        []string{"large.txt"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			gf := gc.GoldenFixtures()
+			gf.Dir = tmpDir
+			gf.Flags = ""
+			if test.Exclude != nil {
+				gf.Exclude = test.Exclude
+			}
+			gf.ExcludeInfo = test.ExcludeInfo
+			diff, err := gf.Diff()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, d := range diff {
+				got = append(got, filepath.Base(d.Path))
+			}
+			if !reflect.DeepEqual(got, test.Want) {
+				t.Errorf("got=%v want=%v", got, test.Want)
+			}
+		})
+	}
+}
+
+func TestGoldenFixturesExcludeContent(t *testing.T) {
+	tmpDir := testDir(t)
+	for name, data := range map[string]string{
+		"empty.txt":  "",
+		"a.txt":      "a",
+		"marker.txt": "GENERATED placeholder",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(tmpDir, name), []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		Name           string
+		ExcludeContent func(path string, data []byte) bool
+		Want           []string
+	}{
+		{
+			Name: "none",
+			Want: []string{"a.txt", "empty.txt", "marker.txt"},
+		},
+		{
+			Name:           "empty",
+			ExcludeContent: ExcludeEmpty,
+			Want:           []string{"a.txt", "marker.txt"},
+		},
+		{
+			Name: "pattern",
+			ExcludeContent: func(_ string, data []byte) bool {
+				return bytes.HasPrefix(data, []byte("GENERATED"))
+			},
+			Want: []string{"a.txt", "empty.txt"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			gf := gc.GoldenFixtures()
+			gf.Dir = tmpDir
+			gf.Flags = ""
+			gf.ExcludeContent = test.ExcludeContent
+			diff, err := gf.Diff()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, d := range diff {
+				if d.Kind != DiffUnexpected {
+					t.Errorf("got=%s want=%s", d.Kind, DiffUnexpected)
+				}
+				got = append(got, filepath.Base(d.Path))
+			}
+			if !reflect.DeepEqual(got, test.Want) {
+				t.Errorf("got=%v want=%v", got, test.Want)
+			}
+		})
+	}
+
+	t.Run("update", func(t *testing.T) {
+		gf := gc.GoldenFixtures()
+		gf.Dir = tmpDir
+		gf.Flags = string(FlagUpdate)
+		gf.ExcludeContent = ExcludeEmpty
+		if err := gf.Test(); err != nil {
+			t.Fatal(err)
+		} else if _, err := os.Stat(filepath.Join(tmpDir, "empty.txt")); err != nil {
+			t.Errorf("got=%v want=nil", err)
+		} else if _, err := os.Stat(filepath.Join(tmpDir, "a.txt")); !os.IsNotExist(err) {
+			t.Errorf("got=%v want not exist", err)
+		}
+	})
+}
+
+func TestLoadFollowSymlinks(t *testing.T) {
+	tmpDir := testDir(t)
+	abs, err := filepath.Abs(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(tmpDir, "target")
+	root := filepath.Join(tmpDir, "root")
+	for _, dir := range []string{target, root} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(target, "a.txt"), []byte("a"), 0600); err != nil {
+		t.Fatal(err)
+	} else if err := os.Symlink(filepath.Join(abs, "target"), filepath.Join(root, "linked")); err != nil {
+		t.Skipf("symlinks not supported: %s", err)
+	} else if err := os.Symlink(filepath.Join(abs, "target", "a.txt"), filepath.Join(root, "b.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	c := gc.WithDir(tmpDir)
+	c.FollowSymlinks = true
+	got, err := c.InputFixtures("root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Fixtures{
+		filepath.Join(root, "b.txt"):           []byte("a"),
+		filepath.Join(root, "linked", "a.txt"): []byte("a"),
+	}
+	if !got.Equal(want) {
+		t.Fatalf("got=%v want=%v", got.Paths(), want.Paths())
+	}
+
+	if err := os.Symlink(filepath.Join(abs, "root"), filepath.Join(target, "cycle")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.InputFixtures("root"); err == nil || !strings.Contains(err.Error(), "symlink cycle: ") {
+		t.Fatalf("got err=%v want symlink cycle", err)
+	}
+
+	gf := c.GoldenFixtures("root")
+	gf.Flags = ""
+	if _, err := gf.Diff(); err == nil || !strings.Contains(err.Error(), "symlink cycle: ") {
+		t.Fatalf("got err=%v want symlink cycle", err)
+	}
+}
+
+func TestLoadReadRetries(t *testing.T) {
+	dir := filepath.Join(gc.Dir, "in", "nested")
+	want, err := Load(dir, IsDotfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(fn func(string) ([]byte, error), d time.Duration) {
+		readFile, readBackoff = fn, d
+	}(readFile, readBackoff)
+	readBackoff = 0
+
+	tests := []struct {
+		Retries int
+		Err     error
+		WantErr error
+	}{
+		{Retries: 2, Err: syscall.EAGAIN},
+		{Retries: 2, Err: syscall.EBUSY},
+		{Retries: 1, Err: syscall.EAGAIN, WantErr: syscall.EAGAIN},
+		{Retries: 0, Err: syscall.EAGAIN, WantErr: syscall.EAGAIN},
+		{Retries: 5, Err: os.ErrNotExist, WantErr: os.ErrNotExist},
+	}
+	for i, test := range tests {
+		failures := map[string]int{}
+		readFile = func(path string) ([]byte, error) {
+			if failures[path] < 2 {
+				failures[path]++
+				return nil, &os.PathError{Op: "read", Path: path, Err: test.Err}
+			}
+			return ioutil.ReadFile(path)
+		}
+		c := gc.WithDir(dir)
+		c.ReadRetries = test.Retries
+		got, err := c.InputFixtures()
+		if !errors.Is(err, test.WantErr) || (test.WantErr == nil && err != nil) {
+			t.Errorf("%d: got err=%v want=%v", i, err, test.WantErr)
+		} else if err == nil && !got.Equal(want) {
+			t.Errorf("%d: got=%v want=%v", i, got.Paths(), want.Paths())
+		}
+	}
+}
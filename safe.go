@@ -0,0 +1,56 @@
+package goldy
+
+import "sync"
+
+// SafeFixtures is like Fixtures, but safe for concurrent use by multiple
+// goroutines, e.g. for adding fixtures rendered in parallel. The zero value
+// is ready to use. Use Fixtures to get a Fixtures that can be used
+// anywhere else.
+type SafeFixtures struct {
+	mu       sync.Mutex
+	fixtures Fixtures
+}
+
+// Add is like Fixtures.Add.
+func (s *SafeFixtures) Add(data []byte, path ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fixtures == nil {
+		s.fixtures = Fixtures{}
+	}
+	s.fixtures.Add(data, path...)
+}
+
+// Get is like Fixtures.Get.
+func (s *SafeFixtures) Get(path ...string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fixtures.Get(path...)
+}
+
+// Len returns the number of fixtures in s.
+func (s *SafeFixtures) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.fixtures)
+}
+
+// Fixtures returns a copy of the fixtures in s.
+func (s *SafeFixtures) Fixtures() Fixtures {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := make(Fixtures, len(s.fixtures))
+	for path, data := range s.fixtures {
+		f[path] = data
+	}
+	return f
+}
+
+// AddSafe is like Add, but safe for concurrent use by multiple goroutines.
+// All other methods of gf, including Add, must not be called concurrently
+// with it.
+func (gf *GoldenFixtures) AddSafe(data []byte, path ...string) {
+	gf.mu.Lock()
+	defer gf.mu.Unlock()
+	gf.Add(data, path...)
+}
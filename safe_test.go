@@ -0,0 +1,48 @@
+package goldy
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestSafeFixtures(t *testing.T) {
+	const n = 100
+	var (
+		s  SafeFixtures
+		gf = gc.GoldenFixtures("tmp")
+		wg sync.WaitGroup
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("%d.txt", i)
+			s.Add([]byte(name), "dir", name)
+			s.Get("dir", name)
+			gf.AddSafe([]byte(name), name)
+		}(i)
+	}
+	wg.Wait()
+
+	f := s.Fixtures()
+	if len(f) != n || s.Len() != n {
+		t.Fatalf("got=%d want=%d", len(f), n)
+	} else if len(gf.Fixtures) != n {
+		t.Fatalf("got=%d want=%d", len(gf.Fixtures), n)
+	}
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("%d.txt", i)
+		if data, ok := s.Get("dir", name); !ok || string(data) != name {
+			t.Errorf("got=%q %v want=%q true", data, ok, name)
+		} else if data, ok := gf.Fixtures.Get(gf.Dir, name); !ok || string(data) != name {
+			t.Errorf("got=%q %v want=%q true", data, ok, name)
+		}
+	}
+
+	// The returned Fixtures is a copy.
+	f.Add([]byte("x"), "x.txt")
+	if _, ok := s.Get("x.txt"); ok {
+		t.Errorf("got=%v want=%v", ok, false)
+	}
+}
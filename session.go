@@ -0,0 +1,117 @@
+package goldy
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Session records the golden fixtures produced by all GoldenFixtures created
+// from a Config during a test run. This allows to detect orphaned golden
+// fixtures, i.e. files on disk that are no longer produced by any test, e.g.
+// because the test was deleted.
+type Session struct {
+	mu      sync.Mutex
+	exclude func(path string) bool
+	dirs    map[string]bool
+	claimed map[string]bool
+}
+
+// NewSession creates a new Session and sets it as c.Session, so all
+// GoldenFixtures created from c afterwards register with it. A typical
+// use is:
+//
+//	var gc = goldy.DefaultConfig()
+//
+//	func TestMain(m *testing.M) {
+//		session := gc.NewSession()
+//		code := m.Run()
+//		if orphans, err := session.Orphans(); err != nil || len(orphans) > 0 {
+//			fmt.Println(orphans, err)
+//			code = 1
+//		}
+//		os.Exit(code)
+//	}
+func (c *Config) NewSession() *Session {
+	exclude := c.Exclude
+	if exclude == nil {
+		exclude = IsDotfile
+	}
+	c.Session = &Session{
+		exclude: exclude,
+		dirs:    map[string]bool{},
+		claimed: map[string]bool{},
+	}
+	return c.Session
+}
+
+// register records dir and the given paths inside of it as claimed.
+func (s *Session) register(dir string, paths []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dirs[filepath.Clean(dir)] = true
+	for _, path := range paths {
+		s.claimed[path] = true
+	}
+}
+
+// Orphans returns the sorted paths of all files inside the dirs of the
+// registered GoldenFixtures that were not produced by any of them. Compressed
+// or encoded golden fixtures with a ".gz" or ".b64" suffix are matched
+// without the suffix.
+func (s *Session) Orphans() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var orphans []string
+	for dir := range s.dirs {
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			} else if info.IsDir() || s.exclude(path) {
+				return nil
+			} else if !s.isClaimed(fixtureKey(path)) {
+				orphans = append(orphans, path)
+			}
+			return nil
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	sort.Strings(orphans)
+	// Dirs may be nested, so the same file can be found more than once.
+	unique := orphans[:0]
+	for i, path := range orphans {
+		if i == 0 || path != orphans[i-1] {
+			unique = append(unique, path)
+		}
+	}
+	return unique, nil
+}
+
+// isClaimed returns true if the given key, with or without a ".b64" and ".gz"
+// suffix, was claimed. It must be called with s.mu held.
+func (s *Session) isClaimed(key string) bool {
+	key = strings.TrimSuffix(key, ".b64")
+	return s.claimed[key] || s.claimed[strings.TrimSuffix(key, ".gz")]
+}
+
+// AssertNoOrphans fails the test via t.Fatalf if Orphans returns any paths or
+// an error. It should be called after all other tests using the session have
+// finished.
+func (s *Session) AssertNoOrphans(t testing.TB) {
+	t.Helper()
+	orphans, err := s.Orphans()
+	if err != nil {
+		t.Fatalf("could not find orphaned golden fixtures: %s", err)
+	} else if len(orphans) > 0 {
+		t.Fatalf(
+			"%d orphaned golden fixtures:\n%s\n\nremove the files above if they are no longer needed",
+			len(orphans),
+			strings.Join(orphans, "\n"),
+		)
+	}
+}
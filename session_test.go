@@ -0,0 +1,69 @@
+package goldy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSession(t *testing.T) {
+	tmpDir := testDir(t)
+	for _, name := range []string{"a/claimed.txt", "a/orphan.txt", "a/.hidden", "b/zipped.txt.gz", "other/unrelated.txt"} {
+		path := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		} else if err := ioutil.WriteFile(path, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := gc.WithDir(tmpDir).WithFlags("")
+	c.IgnoreUnexpected = true
+	session := c.NewSession()
+	if c.Session != session {
+		t.Fatalf("got=%v want=%v", c.Session, session)
+	}
+
+	gfA := c.GoldenFixtures("a")
+	gfA.Add(nil, "claimed.txt")
+	gfB := c.GoldenFixtures("b")
+	gfB.Add(nil, "zipped.txt")
+	for _, gf := range []*GoldenFixtures{gfA, gfB} {
+		if _, err := gf.Diff(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Fixtures created from a copy of the config before NewSession was called
+	// don't register.
+	if err := (Config{Dir: tmpDir}).WithDefaults().GoldenFixture(nil, "other", "unrelated.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	orphans, err := session.Orphans()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(tmpDir, "a", "orphan.txt")}
+	if !reflect.DeepEqual(orphans, want) {
+		t.Errorf("got=%v want=%v", orphans, want)
+	}
+
+	tb := &fakeTB{}
+	session.AssertNoOrphans(tb)
+	if !strings.HasPrefix(tb.fatal, "1 orphaned golden fixtures:\n"+want[0]) {
+		t.Errorf("got fatal=%q", tb.fatal)
+	}
+
+	gfA.Add(nil, "orphan.txt")
+	if _, err := gfA.Diff(); err != nil {
+		t.Fatal(err)
+	}
+	tb = &fakeTB{}
+	session.AssertNoOrphans(tb)
+	if tb.fatal != "" {
+		t.Errorf("got fatal=%q want none", tb.fatal)
+	}
+}
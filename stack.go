@@ -0,0 +1,29 @@
+package goldy
+
+import "regexp"
+
+var (
+	stackGoroutine = regexp.MustCompile(`goroutine \d+`)
+	stackOffset    = regexp.MustCompile(`\+0x[0-9a-f]+`)
+	stackAddr      = regexp.MustCompile(`0x[0-9a-f]+`)
+)
+
+// NormalizeStack returns a copy of stack, as produced by runtime.Stack, with
+// goroutine ids, line offsets and hex addresses replaced by placeholders. This
+// makes stack dumps stable across runs.
+func NormalizeStack(stack []byte) []byte {
+	stack = stackGoroutine.ReplaceAll(stack, []byte("goroutine <id>"))
+	stack = stackOffset.ReplaceAll(stack, []byte("+<offset>"))
+	return stackAddr.ReplaceAll(stack, []byte("<addr>"))
+}
+
+// AddStack is like Add, but normalizes stack using NormalizeStack. The golden
+// fixture on disk is normalized as well before comparing it, so it may also
+// hold a raw stack dump.
+func (gf *GoldenFixtures) AddStack(stack []byte, path ...string) {
+	gf.Add(NormalizeStack(stack), path...)
+	if gf.normalize == nil {
+		gf.normalize = map[string]func([]byte) []byte{}
+	}
+	gf.normalize[gf.join(path...)] = NormalizeStack
+}
@@ -0,0 +1,44 @@
+package goldy
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestNormalizeStack(t *testing.T) {
+	stacks := []string{
+		"goroutine 1 [running]:\n" +
+			"main.work(0xc000012345, 0x1)\n" +
+			"\t/src/main.go:12 +0x1d\n" +
+			"created by main.main in goroutine 7\n" +
+			"\t/src/main.go:8 +0x25\n",
+		"goroutine 42 [running]:\n" +
+			"main.work(0xc0000a0f00, 0x1)\n" +
+			"\t/src/main.go:12 +0x3f\n" +
+			"created by main.main in goroutine 19\n" +
+			"\t/src/main.go:8 +0x2b\n",
+	}
+	want := "goroutine <id> [running]:\n" +
+		"main.work(<addr>, <addr>)\n" +
+		"\t/src/main.go:12 +<offset>\n" +
+		"created by main.main in goroutine <id>\n" +
+		"\t/src/main.go:8 +<offset>\n"
+	for _, stack := range stacks {
+		if got := string(NormalizeStack([]byte(stack))); got != want {
+			t.Errorf("got=%q want=%q", got, want)
+		}
+	}
+
+	tmpDir := testDir(t)
+	if err := ioutil.WriteFile(filepath.Join(tmpDir, "stack.txt"), []byte(stacks[0]), 0600); err != nil {
+		t.Fatal(err)
+	}
+	gf := gc.GoldenFixtures()
+	gf.Dir = tmpDir
+	gf.Flags = ""
+	gf.AddStack([]byte(stacks[1]), "stack.txt")
+	if err := gf.Test(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,217 @@
+package goldy
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FixtureStore stores golden fixtures somewhere other than the local file
+// system, see GoldenFixtures.Store. The paths of the Fixtures passed to and
+// returned by it are relative to dir.
+type FixtureStore interface {
+	// Load returns the golden fixtures stored for dir. If there are none, it
+	// returns an error for which os.IsNotExist returns true.
+	Load(dir string) (Fixtures, error)
+	// Write replaces all golden fixtures stored for dir with f.
+	Write(dir string, f Fixtures) error
+}
+
+// FSStore is a FixtureStore for golden fixtures stored as regular files on
+// the local file system. It's not used by default: if Store is nil,
+// GoldenFixtures reads and writes Dir directly, which also supports options
+// like Compress, EncodeBinary and Modes. FSStore is useful for wrapping the
+// local file system in other stores, e.g. for caching.
+type FSStore struct {
+	// Exclude, if not nil, excludes files from being loaded or removed.
+	Exclude func(path string) bool
+	// FileMode and DirMode are used for writing files and dirs. If zero, the
+	// same defaults as for GoldenFixtures are used.
+	FileMode os.FileMode
+	DirMode  os.FileMode
+}
+
+// Load implements FixtureStore.
+func (s FSStore) Load(dir string) (Fixtures, error) {
+	exclude := s.Exclude
+	if exclude == nil {
+		exclude = func(string) bool { return false }
+	}
+	f, err := Load(dir, exclude)
+	if err != nil {
+		return nil, err
+	}
+	return f.Sub(dir), nil
+}
+
+// Write implements FixtureStore. Files in dir that are not in f and not
+// excluded are removed.
+func (s FSStore) Write(dir string, f Fixtures) error {
+	old, err := s.Load(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	fileMode, dirMode := s.FileMode, s.DirMode
+	if fileMode == 0 {
+		fileMode = defaultFileMode
+	}
+	if dirMode == 0 {
+		dirMode = defaultDirMode
+	}
+	err = f.Walk(func(rel string, data []byte) error {
+		if oldData, ok := old[rel]; ok && bytes.Equal(oldData, data) {
+			return nil
+		}
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), dirMode); err != nil {
+			return err
+		}
+		return writeFile(path, data, fileMode)
+	})
+	if err != nil {
+		return err
+	}
+	for path := range old {
+		if _, ok := f[path]; !ok {
+			if err := os.Remove(filepath.Join(dir, filepath.FromSlash(path))); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// HTTPStore is a FixtureStore for golden fixtures stored on an HTTP server,
+// e.g. an artifact server. The golden fixtures for every dir are stored as a
+// single tar archive, see WriteTar, at URL + "/" + dir + ".tar". Load sends
+// a GET request for it and Write a PUT request. A 404 response means that
+// there are no golden fixtures for dir yet.
+type HTTPStore struct {
+	// URL is the base URL of the store.
+	URL string
+	// Client is used for sending requests. Defaults to http.DefaultClient.
+	Client *http.Client
+	// Header, if not nil, is added to every request, e.g. for authentication.
+	Header http.Header
+}
+
+// Load implements FixtureStore.
+func (s HTTPStore) Load(dir string) (Fixtures, error) {
+	url := s.url(dir)
+	res, err := s.do(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return Fixtures{}, &os.PathError{Op: "get", Path: url, Err: os.ErrNotExist}
+	} else if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, res.Status)
+	}
+	return LoadTar(res.Body)
+}
+
+// Write implements FixtureStore.
+func (s HTTPStore) Write(dir string, f Fixtures) error {
+	buf := &bytes.Buffer{}
+	if err := f.WriteTar(buf); err != nil {
+		return err
+	}
+	url := s.url(dir)
+	res, err := s.do(http.MethodPut, url, buf.Bytes())
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("PUT %s: %s", url, res.Status)
+	}
+	return nil
+}
+
+// url returns the URL of the archive holding the golden fixtures for dir.
+func (s HTTPStore) url(dir string) string {
+	return strings.TrimSuffix(s.URL, "/") + "/" + fixtureKey(dir) + ".tar"
+}
+
+// do sends a request with the given method, url and body.
+func (s HTTPStore) do(method, url string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range s.Header {
+		req.Header[key] = values
+	}
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(req)
+}
+
+// loadStore loads the golden fixtures from gf.Store that are not excluded by
+// gf.Exclude.
+func (gf *GoldenFixtures) loadStore() (Fixtures, error) {
+	s, err := gf.readStore()
+	return s.Filter(func(path string) bool { return !gf.Exclude(filepath.FromSlash(path)) }), err
+}
+
+// readStore reads all golden fixtures from gf.Store, including excluded
+// ones.
+func (gf *GoldenFixtures) readStore() (Fixtures, error) {
+	rel, err := gf.Store.Load(gf.Dir)
+	if err != nil {
+		return Fixtures{}, err
+	}
+	s := Fixtures{}
+	for path, data := range rel {
+		s[gf.join(path)] = data
+	}
+	return s, nil
+}
+
+// checkStore returns an error if gf.Store is set along with options it
+// doesn't support.
+func (gf *GoldenFixtures) checkStore() error {
+	if gf.Store == nil {
+		return nil
+	}
+	var unsupported []string
+	if gf.Compress {
+		unsupported = append(unsupported, "Compress")
+	}
+	if gf.EncodeBinary {
+		unsupported = append(unsupported, "EncodeBinary")
+	}
+	if len(gf.Modes) > 0 {
+		unsupported = append(unsupported, "Modes")
+	}
+	if len(unsupported) > 0 {
+		return fmt.Errorf("options not supported with Store: %s", strings.Join(unsupported, ", "))
+	}
+	return nil
+}
+
+// updateStore resolves diff by writing the updated golden fixtures to
+// gf.Store. Excluded golden fixtures are kept as they are.
+func (gf *GoldenFixtures) updateStore(diff Diff) error {
+	if len(diff) == 0 {
+		return nil
+	}
+	s, err := gf.readStore()
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	rel, err := gf.applyDiff(s, diff)
+	if err != nil {
+		return err
+	} else if err := gf.Store.Write(gf.Dir, rel); err != nil {
+		return err
+	}
+	gf.logf("goldy: wrote: %s (store)", gf.Dir)
+	return nil
+}
@@ -0,0 +1,177 @@
+package goldy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeArtifactServer is an HTTP server storing the bodies of PUT requests in
+// memory and serving them for GET requests.
+type fakeArtifactServer struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+func (s *fakeArtifactServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch r.Method {
+	case http.MethodGet:
+		data, ok := s.files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	case http.MethodPut:
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.files[r.URL.Path] = data
+		w.WriteHeader(http.StatusCreated)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func TestHTTPStore(t *testing.T) {
+	fake := &fakeArtifactServer{files: map[string][]byte{}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	c := gc
+	c.Dir = filepath.Join("remote", "golden")
+	c.Store = HTTPStore{URL: srv.URL + "/"}
+	newGF := func(flags string, files map[string]string) *GoldenFixtures {
+		gf := c.GoldenFixtures()
+		gf.Flags = flags
+		for path, data := range files {
+			gf.Add([]byte(data), path)
+		}
+		return gf
+	}
+
+	files := map[string]string{"a.txt": "a", "sub/b.txt": "b"}
+	if err := newGF("", files).Test(); err == nil || !strings.Contains(err.Error(), "2 errors:\nmissing file: ") {
+		t.Fatalf("got=%v want missing files", err)
+	} else if err := newGF(string(FlagUpdate), files).Test(); err != nil {
+		t.Fatal(err)
+	} else if _, ok := fake.files["/remote/golden.tar"]; !ok {
+		t.Fatalf("got=%v want=%q", fake.files, "/remote/golden.tar")
+	} else if err := newGF("", files).Test(); err != nil {
+		t.Fatal(err)
+	} else if _, err := os.Stat(c.Dir); !os.IsNotExist(err) {
+		t.Fatalf("got=%v want not exist", err)
+	}
+
+	files = map[string]string{"a.txt": "changed"}
+	diff, err := newGF("", files).Diff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "changed file: " + fixtureKey(filepath.Join(c.Dir, "a.txt")) + "\n" +
+		"unexpected file: " + fixtureKey(filepath.Join(c.Dir, "sub", "b.txt"))
+	if got := diff.String(); got != want {
+		t.Fatalf("got=%q want=%q", got, want)
+	} else if err := newGF(string(FlagUpdate), files).Test(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := HTTPStore{URL: srv.URL}.Load(c.Dir)
+	if err != nil {
+		t.Fatal(err)
+	} else if wantF := (Fixtures{"a.txt": []byte("changed")}); !reflect.DeepEqual(got, wantF) {
+		t.Errorf("got=%v want=%v", got, wantF)
+	}
+}
+
+func TestGoldenFixturesStoreExclude(t *testing.T) {
+	c := TempConfig(t)
+	store := FSStore{}
+	c.Store = store
+	golden := filepath.Join(c.Dir, "golden")
+	if err := store.Write(golden, Fixtures{"a.txt": []byte("old"), "b.txt": []byte("old"), ".keep": []byte{}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Updates and rewrites leave excluded golden fixtures alone.
+	for _, flags := range []string{"update", "rewrite"} {
+		gf := c.GoldenFixtures("golden")
+		gf.Flags = flags
+		gf.Add([]byte(flags), "a.txt")
+		if err := gf.Test(); err != nil {
+			t.Fatal(err)
+		}
+		want := Fixtures{"a.txt": []byte(flags), ".keep": []byte{}}
+		if got, err := store.Load(golden); err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: got=%q want=%q", flags, got, want)
+		}
+	}
+
+	gf := c.GoldenFixtures("golden")
+	gf.Compress = true
+	gf.Modes = map[string]os.FileMode{gf.join("a.txt"): 0700}
+	gf.Add([]byte("update"), "a.txt")
+	want := "options not supported with Store: Compress, Modes"
+	if err := gf.Test(); err == nil || err.Error() != want {
+		t.Fatalf("got err=%v want=%v", err, want)
+	}
+}
+
+func TestHTTPStoreErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	s := HTTPStore{URL: srv.URL}
+	if _, err := s.Load("a"); err == nil || !strings.Contains(err.Error(), "401 Unauthorized") {
+		t.Errorf("got=%v want 401", err)
+	} else if err := s.Write("a", Fixtures{}); err == nil || !strings.Contains(err.Error(), "401 Unauthorized") {
+		t.Errorf("got=%v want 401", err)
+	}
+	s.Header = http.Header{"Authorization": {"token"}}
+	if err := s.Write("a", Fixtures{}); err != nil {
+		t.Errorf("got=%v want=nil", err)
+	}
+}
+
+func TestFSStore(t *testing.T) {
+	dir := testDir(t)
+	if err := ioutil.WriteFile(filepath.Join(dir, ".keep"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	s := FSStore{Exclude: IsDotfile}
+	want := Fixtures{"a.txt": []byte("a"), "sub/b.txt": []byte("b")}
+	if err := s.Write(dir, want); err != nil {
+		t.Fatal(err)
+	} else if got, err := s.Load(dir); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got=%v want=%v", got, want)
+	}
+	want = Fixtures{"c.txt": []byte("c")}
+	if err := s.Write(dir, want); err != nil {
+		t.Fatal(err)
+	} else if got, err := s.Load(dir); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got=%v want=%v", got, want)
+	} else if _, err := os.Stat(filepath.Join(dir, ".keep")); err != nil {
+		t.Errorf("got=%v want=nil", err)
+	} else if _, err := s.Load(filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Errorf("got=%v want not exist", err)
+	}
+}
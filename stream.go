@@ -0,0 +1,144 @@
+package goldy
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+// GoldenComparer returns a writer that compares the data written to it
+// against the golden fixture at the given path inside c.Dir as it arrives,
+// e.g. for the output of a long running generator. Write returns an error as
+// soon as the data diverges from the golden fixture, Close returns an error
+// if the lengths differ. Both return the same error for all later calls.
+//
+// If c has flags or options that do more than a plain comparison, e.g.
+// FlagUpdate, FlagJSON, Transform, AutoCreate or OnMismatch, the data is
+// buffered instead, and Close compares or updates it like GoldenFixture.
+func (c Config) GoldenComparer(path ...string) (io.WriteCloser, error) {
+	flags, err := parseFlags(c.Flags)
+	if err != nil {
+		return nil, err
+	}
+	gf := c.GoldenFixtures(path...)
+	gf.IgnoreUnexpected = true
+	gc := &goldenComparer{gf: gf}
+	if !gf.incremental(flags) {
+		gc.buf = &bytes.Buffer{}
+		return gc, nil
+	}
+	file, err := os.Open(gf.Dir)
+	if os.IsNotExist(err) {
+		gc.err = gc.mismatch("missing file: %s", gf.displayPath(gf.join()))
+		return gc, nil
+	} else if err != nil {
+		return nil, err
+	}
+	gc.file, gc.golden = file, bufio.NewReader(file)
+	return gc, nil
+}
+
+// incremental returns true if gf can be compared byte by byte against the
+// golden fixture on disk according to flags, see GoldenComparer.
+func (gf *GoldenFixtures) incremental(flags map[Flag]bool) bool {
+	for _, flag := range []Flag{FlagUpdate, FlagRewrite, FlagInteractive, FlagJSON, FlagQuiet, FlagStats, FlagVerbose} {
+		if flags[flag] {
+			return false
+		}
+	}
+	return gf.Transform == nil && len(gf.Comparators) == 0 && !gf.Compress &&
+		!gf.EncodeBinary && !gf.Archive && gf.Store == nil && gf.Reference == nil &&
+		!gf.IgnoreTrailingWhitespace && len(gf.IgnorePatterns) == 0 &&
+		!gf.VerifyChecksums && gf.MaxFixtureSize == 0 && !gf.AutoCreate &&
+		!gf.ContentOnlyFailures && gf.OnMismatch == nil && gf.ArtifactsDir == "" &&
+		gf.Only == "" && gf.Session == nil
+}
+
+// goldenComparer implements GoldenComparer.
+type goldenComparer struct {
+	gf *GoldenFixtures
+	// buf holds the written data if it's compared on Close instead.
+	buf *bytes.Buffer
+	// file and golden read the golden fixture.
+	file   *os.File
+	golden *bufio.Reader
+	// scratch holds the golden data compared by Write.
+	scratch []byte
+	// n is the number of bytes that matched so far.
+	n int64
+	// err is returned by all calls after the first mismatch.
+	err    error
+	closed bool
+}
+
+// Write implements io.Writer.
+func (c *goldenComparer) Write(p []byte) (int, error) {
+	if c.buf != nil {
+		return c.buf.Write(p)
+	} else if c.err != nil {
+		return 0, c.err
+	}
+	if cap(c.scratch) < len(p) {
+		c.scratch = make([]byte, len(p))
+	}
+	golden := c.scratch[:len(p)]
+	m, err := io.ReadFull(c.golden, golden)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		c.err = err
+		return 0, err
+	}
+	for i := 0; i < m; i++ {
+		if p[i] != golden[i] {
+			c.err = c.changed("first difference at byte %d", c.n+int64(i))
+			return i, c.err
+		}
+	}
+	c.n += int64(m)
+	if m < len(p) {
+		c.err = c.changed("golden fixture ends at byte %d", c.n)
+		return m, c.err
+	}
+	return m, nil
+}
+
+// Close implements io.Closer.
+func (c *goldenComparer) Close() error {
+	if c.closed {
+		return c.err
+	}
+	c.closed = true
+	if c.buf != nil {
+		c.gf.Add(c.buf.Bytes())
+		c.err = c.gf.Test()
+		return c.err
+	} else if c.file == nil {
+		return c.err
+	}
+	defer c.file.Close()
+	if c.err != nil {
+		return c.err
+	} else if _, err := c.golden.ReadByte(); err == nil {
+		c.err = c.changed("data ends at byte %d, golden fixture is longer", c.n)
+	} else if err != io.EOF {
+		c.err = err
+	}
+	return c.err
+}
+
+// changed returns the error for a changed golden fixture with the detail
+// formatted according to format and args.
+func (c *goldenComparer) changed(format string, args ...interface{}) error {
+	return c.mismatch("changed file: %s (%s)", c.gf.displayPath(c.gf.join()), fmt.Sprintf(format, args...))
+}
+
+// mismatch returns an error like the one returned by Test for a single
+// mismatching golden fixture described by format and args.
+func (c *goldenComparer) mismatch(format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	if c.gf.Hint == "" {
+		return fmt.Errorf("1 errors:\n%s", msg)
+	}
+	return fmt.Errorf("1 errors:\n%s\n\n%s", msg, c.gf.updateHint())
+}
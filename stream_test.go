@@ -0,0 +1,120 @@
+package goldy
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGoldenComparer(t *testing.T) {
+	c := gc
+	c.Dir = testDir(t)
+	path := filepath.Join(c.Dir, "out.txt")
+
+	// writeAll writes chunks to a new comparer and returns the first error
+	// returned by Write and the error returned by Close.
+	writeAll := func(chunks ...string) (writeErr, closeErr error) {
+		t.Helper()
+		w, err := c.GoldenComparer("out.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, chunk := range chunks {
+			if _, err := io.WriteString(w, chunk); err != nil && writeErr == nil {
+				writeErr = err
+			}
+		}
+		return writeErr, w.Close()
+	}
+
+	c.Flags = ""
+	if writeErr, closeErr := writeAll("a\n"); writeErr == nil || !strings.Contains(writeErr.Error(), "missing file: "+path) {
+		t.Fatalf("got err=%v", writeErr)
+	} else if closeErr != writeErr {
+		t.Fatalf("got=%v want=%v", closeErr, writeErr)
+	}
+
+	c.Flags = string(FlagUpdate)
+	if writeErr, closeErr := writeAll("line 1\n", "line 2\n", "line 3\n"); writeErr != nil || closeErr != nil {
+		t.Fatalf("got=%v %v", writeErr, closeErr)
+	} else if data, err := ioutil.ReadFile(path); err != nil {
+		t.Fatal(err)
+	} else if string(data) != "line 1\nline 2\nline 3\n" {
+		t.Fatalf("got=%q", data)
+	}
+
+	c.Flags = ""
+	t.Run("exact match", func(t *testing.T) {
+		if writeErr, closeErr := writeAll("line", " 1\nline 2\n", "", "line 3\n"); writeErr != nil || closeErr != nil {
+			t.Fatalf("got=%v %v", writeErr, closeErr)
+		}
+	})
+
+	t.Run("early divergence", func(t *testing.T) {
+		w, err := c.GoldenComparer("out.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "changed file: " + path + " (first difference at byte 12)"
+		if n, err := io.WriteString(w, "line 1\n"); err != nil || n != 7 {
+			t.Fatalf("got n=%d err=%v", n, err)
+		} else if n, err := io.WriteString(w, "line X\nline 3\n"); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("got err=%v want=%v", err, want)
+		} else if n != 5 {
+			t.Fatalf("got=%d want=%d", n, 5)
+		} else if _, err2 := io.WriteString(w, "line 3\n"); err2 != err {
+			t.Fatalf("got=%v want=%v", err2, err)
+		} else if err2 := w.Close(); err2 != err {
+			t.Fatalf("got=%v want=%v", err2, err)
+		}
+	})
+
+	t.Run("length mismatch", func(t *testing.T) {
+		want := "changed file: " + path + " (data ends at byte 14, golden fixture is longer)"
+		if writeErr, closeErr := writeAll("line 1\nline 2\n"); writeErr != nil {
+			t.Fatal(writeErr)
+		} else if closeErr == nil || !strings.Contains(closeErr.Error(), want) {
+			t.Fatalf("got err=%v want=%v", closeErr, want)
+		}
+		want = "changed file: " + path + " (golden fixture ends at byte 21)"
+		if writeErr, closeErr := writeAll("line 1\nline 2\nline 3\nline 4\n"); writeErr == nil || !strings.Contains(writeErr.Error(), want) {
+			t.Fatalf("got err=%v want=%v", writeErr, want)
+		} else if closeErr != writeErr {
+			t.Fatalf("got=%v want=%v", closeErr, writeErr)
+		}
+	})
+
+	t.Run("auto create", func(t *testing.T) {
+		c := c
+		c.AutoCreate = true
+		w, err := c.GoldenComparer("new.txt")
+		if err != nil {
+			t.Fatal(err)
+		} else if _, err := io.WriteString(w, "new\n"); err != nil {
+			t.Fatal(err)
+		} else if err := w.Close(); err != nil {
+			t.Fatal(err)
+		} else if data, err := ioutil.ReadFile(filepath.Join(c.Dir, "new.txt")); err != nil {
+			t.Fatal(err)
+		} else if string(data) != "new\n" {
+			t.Fatalf("got=%q want=%q", data, "new\n")
+		}
+	})
+
+	t.Run("buffered", func(t *testing.T) {
+		// With a Transform the data is only compared on Close.
+		c := c
+		c.Transform = func(_ string, data []byte) []byte { return bytes.ToUpper(data) }
+		w, err := c.GoldenComparer("out.txt")
+		if err != nil {
+			t.Fatal(err)
+		} else if _, err := io.WriteString(w, "line 4\n"); err != nil {
+			t.Fatal(err)
+		} else if err := w.Close(); err == nil || !strings.Contains(err.Error(), "changed file: "+path) {
+			t.Fatalf("got err=%v", err)
+		}
+	})
+}